@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	authSAML        = "saml"
+	authPassword    = "password"
+	authCertificate = "certificate"
+)
+
+var authTypes = []string{authSAML, authPassword, authCertificate}
+
+// resolveAuthType picks the authentication flow for a profile, its configured auth wins over the one
+// detected from the .ovpn file.
+func resolveAuthType(configured, detected string) (string, error) {
+	if configured == "" {
+		return detected, nil
+	}
+
+	for _, t := range authTypes {
+		if t == configured {
+			return configured, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown auth '%s', expected %s", configured, strings.Join(authTypes, ", "))
+}
+
+// stdinReader is shared by every prompt, a reader per prompt would lose whatever the previous one buffered
+// past its line when stdin isn't a terminal.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// readLine prompts on stderr and reads a line from the terminal, without echoing it if secret is set.
+func readLine(prompt string, secret bool) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	if secret {
+		stty := exec.Command("stty", "-echo")
+		stty.Stdin = os.Stdin
+
+		if err := stty.Run(); err != nil {
+			return "", fmt.Errorf("can't hide password input, is this a terminal? %w", err)
+		}
+
+		defer func() {
+			stty := exec.Command("stty", "echo")
+			stty.Stdin = os.Stdin
+			stty.Run()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := stdinReader.ReadString('\n')
+
+	// The last line of piped input may lack its newline.
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// passwordFromCommand runs the profile's password command as the invoking user and returns its first line,
+// so passwords can come from a password manager instead of the terminal.
+func passwordFromCommand(c *config, command string) (string, error) {
+	cmd, err := commandAsNonRoot(c.Vpn.User, hookShell, "-c", command)
+
+	if err != nil {
+		return "", err
+	}
+
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	return strings.SplitN(string(out), "\n", 2)[0], nil
+}
+
+// passwordCredentials gets the username and password for Active Directory (auth-user-pass) endpoints
+// from the profile or the secret store, falling back to asking for them.
+func passwordCredentials(c *config, store secretStore, profileName string) (username, password string, err error) {
+	p := c.profile(profileName)
+	username = p.Username
+
+	if username == "" {
+		if username, err = readLine("Username for "+profileName+": ", false); err != nil {
+			return
+		}
+	}
+
+	if p.PasswordCommand != "" {
+		log.Debug().Str("profile", profileName).Msg("Getting password from password command")
+		password, err = passwordFromCommand(c, p.PasswordCommand)
+
+		return
+	}
+
+	if store != nil {
+		password, err = store.Get(passwordSecretName(profileName))
+
+		if err == nil {
+			log.Debug().Str("profile", profileName).Msg("Using password from secret store")
+			password = strings.TrimRight(password, "\r\n")
+
+			return
+		}
+
+		if err != errSecretNotFound {
+			log.Warn().Err(err).Msg("Failed reading password from secret store")
+		}
+	}
+
+	password, err = readLine("Password for "+username+": ", true)
+
+	return
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeStdin feeds input to readLine for the rest of the test.
+func fakeStdin(t *testing.T, input string) {
+	t.Helper()
+
+	previous := stdinReader
+	stdinReader = bufio.NewReader(strings.NewReader(input))
+
+	t.Cleanup(func() { stdinReader = previous })
+}
+
+func TestReadLinePipedInput(t *testing.T) {
+	// All of it arrives at once, the first prompt mustn't swallow the second line.
+	fakeStdin(t, "alice\r\nsecond line\nlast line without newline")
+
+	for _, want := range []string{"alice", "second line", "last line without newline"} {
+		if got, err := readLine("> ", false); err != nil || got != want {
+			t.Fatalf("readLine = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	if _, err := readLine("> ", false); err != io.EOF {
+		t.Errorf("readLine at the end of input: %v, want io.EOF", err)
+	}
+}
+
+func TestPasswordCredentialsAsksForUsername(t *testing.T) {
+	fakeStdin(t, "alice\n")
+
+	c := &config{Profiles: map[string]profile{"corp": {}}}
+	store := newMemoryStore(map[string]string{passwordSecretName("corp"): "hunter2"})
+
+	username, password, err := passwordCredentials(c, store, "corp")
+
+	if err != nil || username != "alice" || password != "hunter2" {
+		t.Errorf("passwordCredentials = %q, %q, %v, want alice, hunter2", username, password, err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -23,6 +24,38 @@ func main() {
 	app.Name = appName
 	app.Usage = "Connects to AWS VPN service via cli without the official VPN Client hassle."
 	app.EnableBashCompletion = true
+	app.Before = setupLogging
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:  "log-format",
+			Value: "console",
+			Usage: "log output format: json or console",
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "minimum log level: trace, debug, info, warn or error. Overrides the debug config option",
+		},
+		&cli.StringFlag{
+			TakesFile: true,
+			Name:      "log-file",
+			Usage:     "write logs to this file instead of stderr",
+		},
+		&cli.IntFlag{
+			Name:  "log-max-size",
+			Value: 10,
+			Usage: "size in megabytes a log file may reach before it is rotated",
+		},
+		&cli.IntFlag{
+			Name:  "log-max-backups",
+			Value: 3,
+			Usage: "number of rotated log files to keep",
+		},
+		&cli.BoolFlag{
+			Name:  "unsafe-debug",
+			Usage: "disable redaction of SAML assertions, passwords, session IDs and keys in logs",
+		},
+	}
 
 	app.Commands = []*cli.Command{
 		{
@@ -51,30 +84,189 @@ func main() {
 					Required:  false,
 					Name:      "patch",
 					Aliases:   []string{"p"},
-					Value:     "scripts/openvpn-v2.5.1-aws.patch",
-					Usage:     "patch file to use against openvpn source code",
+					Usage:     "patch file to use against openvpn source code. Uses the embedded " + defaultPatchName + " by default",
+				},
+			},
+		},
+		{
+			Name:  "patch",
+			Usage: "Inspect the openvpn patches embedded in this binary.",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "list",
+					Usage:  "Lists every embedded patch.",
+					Action: patchListAction,
+				},
+				{
+					Name:   "export",
+					Usage:  "Writes an embedded patch to disk.",
+					Action: patchExportAction,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "name",
+							Aliases: []string{"n"},
+							Value:   defaultPatchName,
+							Usage:   "embedded patch to export",
+						},
+						&cli.StringFlag{
+							TakesFile: true,
+							Name:      "out",
+							Aliases:   []string{"o"},
+							Value:     ".",
+							Usage:     "directory to write the patch to",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:      "import",
+			Usage:     "Copies an .ovpn file downloaded from AWS into the config folder and adds a profile for it.",
+			ArgsUsage: "[--name profile] <file.ovpn>",
+			Action:    importAction,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "name",
+					Aliases: []string{"n"},
+					Usage:   "profile name. Defaults to the filename without extension",
+				},
+			},
+		},
+		{
+			Name:  "secret",
+			Usage: "Manages credentials in the configured secrets backend.",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "set",
+					Usage:     "Stores a secret, e.g. prod/password. Asks for the value unless --from-file is given.",
+					ArgsUsage: "[--from-file file] <name>",
+					Action:    secretSetAction,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							TakesFile: true,
+							Name:      "from-file",
+							Aliases:   []string{"f"},
+							Usage:     "read the value from a file, e.g. a private key",
+						},
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "Deletes a secret.",
+					ArgsUsage: "<name>",
+					Action:    secretDeleteAction,
+				},
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "Inspects openvpn configurations.",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "render",
+					Usage:  "Prints the openvpn configuration generated from an .ovpn file after applying the config rules. Key material is redacted unless --unsafe-debug is set.",
+					Action: configRenderAction,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							TakesFile: true,
+							Name:      "config",
+							Aliases:   []string{"c"},
+							Usage:     "raw openvpn configuration. Defaults to the config of the imported --profile",
+						},
+						&cli.StringFlag{
+							Name:    "profile",
+							Aliases: []string{"p"},
+							Usage:   "profile whose rules to apply. Defaults to the openvpn configuration filename without extension",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Checks the config and verifies the configured openvpn binary is patched for AWS.",
+			Action: doctorAction,
+		},
+		{
+			Name:   "bundle",
+			Usage:  "Collects redacted config, logs and system info into a tarball for bug reports.",
+			Action: bundleAction,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					TakesFile: true,
+					Name:      "config",
+					Aliases:   []string{"c"},
+					Usage:     "raw openvpn configuration to include with certificates and keys stripped",
+				},
+				&cli.StringFlag{
+					TakesFile: true,
+					Name:      "out",
+					Aliases:   []string{"o"},
+					Usage:     "tarball location. Defaults to " + appName + "-bundle-<time>.tar.gz in the working directory",
 				},
 			},
 		},
 		{
-			Name:    "serve",
-			Aliases: []string{"host", "start"},
-			Usage:   "Loads openvpn configuration file and runs SAML server and openvpn.",
-			Action:  serveAction,
+			Name:      "status",
+			Usage:     "Shows the state of running tunnels. Exits non-zero when none are connected.",
+			ArgsUsage: "[profile]",
+			Action:    statusAction,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print machine readable output",
+				},
+			},
+		},
+		{
+			Name:      "stop",
+			Aliases:   []string{"disconnect"},
+			Usage:     "Stops a running tunnel and cleans up after it.",
+			ArgsUsage: "[profile]",
+			Action:    stopAction,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:    "timeout",
+					Aliases: []string{"t"},
+					Value:   30 * time.Second,
+					Usage:   "how long to wait for the tunnel to tear down",
+				},
+			},
+		},
+		{
+			Name:      "hook",
+			Usage:     "Run by openvpn as its up, route-up and down script, not meant to be run by hand.",
+			ArgsUsage: "up|route-up|down",
+			Hidden:    true,
+			Action:    hookAction,
+		},
+		{
+			Name:      "serve",
+			Aliases:   []string{"host", "start"},
+			Usage:     "Loads openvpn configuration file and runs SAML server and openvpn.",
+			ArgsUsage: "[-- extra openvpn options]",
+			Action:    serveAction,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					TakesFile: true,
-					Required:  true,
 					Name:      "config",
 					Aliases:   []string{"c"},
-					Usage:     "raw openvpn configuration",
+					Usage:     "raw openvpn configuration. Defaults to the config of the imported --profile",
 				},
 				&cli.StringFlag{
 					TakesFile: true,
 					Name:      "configTmpDir",
 					Aliases:   []string{"t"},
-					Value:     os.TempDir(),
-					Usage:     "Temp folder location of formatted openvpn configurations.",
+					Usage:     "Parent folder of the private session directory holding formatted openvpn configurations. Defaults to $XDG_RUNTIME_DIR or the temp folder.",
+				},
+				&cli.StringFlag{
+					Name:    "profile",
+					Aliases: []string{"p"},
+					Usage:   "name of this connection for status and other commands. Defaults to the openvpn configuration filename without extension",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "stop an already running session of the same profile first",
 				},
 			},
 		},
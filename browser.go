@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// privateBrowsingFlags opens a private window for the browsers we know, keyed by executable name.
+var privateBrowsingFlags = map[string]string{
+	"firefox":              "--private-window",
+	"firefox-esr":          "--private-window",
+	"librewolf":            "--private-window",
+	"chromium":             "--incognito",
+	"chromium-browser":     "--incognito",
+	"google-chrome":        "--incognito",
+	"google-chrome-stable": "--incognito",
+	"brave":                "--incognito",
+	"brave-browser":        "--incognito",
+	"vivaldi":              "--incognito",
+	"microsoft-edge":       "--inprivate",
+}
+
+// UnmarshalYAML accepts the old "browser: true" as well as a browser section. A section enables the
+// browser unless it sets enabled: false.
+func (b *browser) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&b.Enabled); err == nil {
+		return nil
+	}
+
+	var section struct {
+		Enabled *bool
+		Command string
+		Private bool
+	}
+
+	if err := unmarshal(&section); err != nil {
+		return err
+	}
+
+	b.Enabled = section.Enabled == nil || *section.Enabled
+	b.Command = strings.TrimSpace(section.Command)
+	b.Private = section.Private
+
+	return nil
+}
+
+// browserCommandLine picks the browser to run: browser.command, then the first installed entry of
+// $BROWSER, then the desktop's default through xdg-open (or open on macOS).
+func browserCommandLine(b browser) string {
+	// A blank command falls back like an unset one, browserCommand needs at least one field.
+	if strings.TrimSpace(b.Command) != "" {
+		return b.Command
+	}
+
+	for _, candidate := range strings.Split(os.Getenv("BROWSER"), ":") {
+		if fields := strings.Fields(candidate); len(fields) > 0 && commandExists(fields[0]) {
+			return candidate
+		}
+	}
+
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+
+	return "xdg-open"
+}
+
+// browserCommand builds the command opening url. The url replaces %s like in $BROWSER, is appended to a
+// last argument ending with = (e.g. chromium --app=) and otherwise passed as the last argument.
+func browserCommand(b browser, url string) (command string, args []string) {
+	fields := strings.Fields(browserCommandLine(b))
+	command, args = fields[0], fields[1:]
+
+	if b.Private {
+		if flag, ok := privateBrowsingFlags[path.Base(command)]; ok {
+			args = append([]string{flag}, args...)
+		} else {
+			log.Warn().Str("browser", command).Msg("Don't know how to open a private window with this browser, set browser.command to one that does")
+		}
+	}
+
+	for i, arg := range args {
+		if strings.Contains(arg, "%s") {
+			args[i] = strings.ReplaceAll(arg, "%s", url)
+			return
+		}
+	}
+
+	if len(args) > 0 && strings.HasSuffix(args[len(args)-1], "=") {
+		args[len(args)-1] += url
+		return
+	}
+
+	return command, append(args, url)
+}
+
+// openBrowser opens url in the configured browser as the invoking (non-root) user.
+func openBrowser(c *config, url string) error {
+	command, args := browserCommand(c.Browser, url)
+
+	if !commandExists(command) {
+		return fmt.Errorf("browser command '%s' not found", command)
+	}
+
+	log.Debug().Str("command", command).Strs("args", args).Msg("Opening browser")
+
+	return commandAndStartAsNonRoot(c.Vpn.User, command, args...)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	defaultBrowser := "xdg-open"
+
+	if runtime.GOOS == "darwin" {
+		defaultBrowser = "open"
+	}
+
+	const url = "https://portal.sso.example.com/saml?SAMLRequest=abc"
+
+	tests := []struct {
+		name    string
+		browser browser
+		envVar  string
+		command string
+		args    []string
+	}{
+		{name: "desktop default", command: defaultBrowser, args: []string{url}},
+		{name: "blank command falls back", browser: browser{Command: " \t "}, command: defaultBrowser, args: []string{url}},
+		{name: "configured command", browser: browser{Command: "firefox --new-window"}, command: "firefox", args: []string{"--new-window", url}},
+		{name: "placeholder", browser: browser{Command: "surf -b %s -x"}, command: "surf", args: []string{"-b", url, "-x"}},
+		{name: "trailing equals", browser: browser{Command: "chromium --app="}, command: "chromium", args: []string{"--app=" + url}},
+		{name: "private window", browser: browser{Command: "/usr/bin/firefox", Private: true}, command: "/usr/bin/firefox", args: []string{"--private-window", url}},
+		{name: "private unknown browser", browser: browser{Command: "surf", Private: true}, command: "surf", args: []string{url}},
+		{name: "BROWSER skips missing entries", envVar: "no-such-browser-aws-vpn-client:sh -c", command: "sh", args: []string{"-c", url}},
+		{name: "command wins over BROWSER", browser: browser{Command: "firefox"}, envVar: "sh", command: "firefox", args: []string{url}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROWSER", tt.envVar)
+
+			command, args := browserCommand(tt.browser, url)
+
+			if command != tt.command || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("browserCommand = %q %q, want %q %q", command, args, tt.command, tt.args)
+			}
+		})
+	}
+}
+
+func TestBrowserConfig(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want browser
+	}{
+		{yaml: "browser: true", want: browser{Enabled: true}},
+		{yaml: "browser: false", want: browser{}},
+		{yaml: "browser:\n  command: \"  firefox  \"\n  private: true", want: browser{Enabled: true, Command: "firefox", Private: true}},
+		{yaml: "browser:\n  enabled: false\n  command: \" \"", want: browser{}},
+	}
+
+	for _, tt := range tests {
+		var c config
+
+		if err := yaml.Unmarshal([]byte(tt.yaml), &c); err != nil {
+			t.Fatalf("parsing %q: %v", tt.yaml, err)
+		}
+
+		if c.Browser != tt.want {
+			t.Errorf("parsing %q gave %+v, want %+v", tt.yaml, c.Browser, tt.want)
+		}
+	}
+}
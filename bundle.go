@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+type (
+	bundleFile struct {
+		Name    string
+		Content []byte
+	}
+)
+
+var (
+	// Any config key that looks like it holds a credential is blanked out.
+	sensitiveConfigKeyRegex = regexp.MustCompile(`(?im)^(\s*-?\s*[\w-]*(password|secret|token|passphrase|key)[\w-]*\s*:).*$`)
+
+	// Inline certificate and key sections of an .ovpn file.
+	openVPNInlineSectionRegex = regexp.MustCompile(`(?s)<(ca|cert|extra-certs|key|tls-auth|tls-crypt|tls-crypt-v2|secret|pkcs12|dh)>.*?</(ca|cert|extra-certs|key|tls-auth|tls-crypt|tls-crypt-v2|secret|pkcs12|dh)>`)
+)
+
+func sanitizeConfig(content []byte) []byte {
+	return []byte(redact(sensitiveConfigKeyRegex.ReplaceAllString(string(content), "${1} "+redactedPlaceholder)))
+}
+
+func sanitizeOpenVPNConfig(content []byte) []byte {
+	return []byte(redact(openVPNInlineSectionRegex.ReplaceAllString(string(content), "<$1>"+redactedPlaceholder+"</$1>")))
+}
+
+func systemInfo() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "client: %s\n", appName)
+	fmt.Fprintf(&b, "os: %s\narch: %s\ngo: %s\nroot: %t\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), isRoot())
+
+	if out, err := exec.Command("uname", "-a").CombinedOutput(); err == nil {
+		fmt.Fprintf(&b, "uname: %s", out)
+	}
+
+	if release, err := os.ReadFile("/etc/os-release"); err == nil {
+		b.WriteString("\n# /etc/os-release\n")
+		b.Write(release)
+	}
+
+	return b.String()
+}
+
+// collectBundleFiles gathers everything we want in a bug report. Missing pieces are noted in the
+// bundle instead of failing, a partial bundle is still more useful than none.
+func collectBundleFiles(openVPNConfigFilename string) (files []bundleFile) {
+	note := func(name string, err error) {
+		files = append(files, bundleFile{Name: name, Content: []byte("unavailable: " + redact(err.Error()) + "\n")})
+	}
+
+	var c *config
+
+	configFilename, err := searchConfigFilename()
+
+	if err == nil {
+		var content []byte
+		content, err = os.ReadFile(configFilename)
+
+		if err == nil {
+			files = append(files, bundleFile{Name: defaultConfigFilename, Content: sanitizeConfig(content)})
+			c, _ = loadConfig(configFilename)
+		}
+	}
+
+	if err != nil {
+		note(defaultConfigFilename, err)
+	}
+
+	if openVPNConfigFilename != "" {
+		content, err := os.ReadFile(openVPNConfigFilename)
+
+		if err != nil {
+			note("profile.ovpn", err)
+		} else {
+			files = append(files, bundleFile{Name: "profile.ovpn", Content: sanitizeOpenVPNConfig(content)})
+		}
+	}
+
+	if c != nil {
+		out, err := exec.Command(c.Vpn.OpenVPN, "--version").CombinedOutput()
+
+		if err != nil && len(out) == 0 {
+			note("openvpn-version.txt", err)
+		} else {
+			files = append(files, bundleFile{Name: "openvpn-version.txt", Content: []byte(redact(string(out)))})
+		}
+	}
+
+	files = append(files, bundleFile{Name: "system.txt", Content: []byte(systemInfo())})
+
+	doctor, err := json.MarshalIndent(runDoctorChecks(), "", "  ")
+
+	if err != nil {
+		note("doctor.json", err)
+	} else {
+		files = append(files, bundleFile{Name: "doctor.json", Content: []byte(redact(string(doctor)))})
+	}
+
+	// serve may have run under sudo, its session log is in the invoking user's config folder.
+	configDir, _, err := getUserConfigPath("")
+
+	if err == nil {
+		var content []byte
+		content, err = os.ReadFile(path.Join(configDir, sessionLogFilename))
+
+		if err == nil {
+			files = append(files, bundleFile{Name: sessionLogFilename, Content: []byte(redact(string(content)))})
+		}
+	}
+
+	if err != nil {
+		note(sessionLogFilename, err)
+	}
+
+	return
+}
+
+func writeBundle(filename string, files []bundleFile) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for _, file := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(strings.TrimSuffix(path.Base(filename), ".tar.gz"), file.Name),
+			Mode:     0600,
+			Size:     int64(len(file.Content)),
+			ModTime:  now,
+		}
+
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err = tw.Write(file.Content); err != nil {
+			return err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// bundleAction writes a tarball of redacted diagnostics to attach to issues.
+func bundleAction(c *cli.Context) error {
+	filename := c.String("out")
+
+	if filename == "" {
+		filename = appName + "-bundle-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	}
+
+	files := collectBundleFiles(c.String("config"))
+
+	err := writeBundle(filename, files)
+
+	if err != nil {
+		log.Error().Err(err).Str("bundle", filename).Msg("Failed writing support bundle! " + errorSuffix)
+		return err
+	}
+
+	log.Info().Msgf("Wrote support bundle: %s", filename)
+	log.Info().Msg("Secrets have been redacted, but please look it over before attaching it to " + bugReportUrl)
+
+	return nil
+}
@@ -13,20 +13,74 @@ type (
 		Shell     string
 		ShellArgs []string
 		User      string
+		Rules     []configRule
+	}
+
+	// browser opens the SAML login, "browser: true" is short for a section with just enabled set.
+	browser struct {
+		Enabled bool
+		Command string
+		Private bool
 	}
 
 	server struct {
 		Addr string
+		// Templates is a directory whose index.html and error.html replace the embedded callback pages.
+		Templates string
+		// TLS serves the callback over https, with Cert and Key or a generated self-signed certificate.
+		TLS  bool
+		Cert string
+		Key  string
+	}
+
+	dns struct {
+		Mode  string
+		Split bool
+	}
+
+	secrets struct {
+		Backend      string
+		File         string
+		RememberSAML bool
+	}
+
+	// routes overrides which routes a profile installs, see routeArgs.
+	routes struct {
+		NoPull  bool
+		Allow   []string
+		Add     []string
+		Exclude []string
+	}
+
+	profile struct {
+		Config          string
+		Auth            string
+		Username        string
+		PasswordCommand string
+		KeySecret       string
+		Routes          routes
+		OpenVPNArgs     []string
+		Rules           []configRule
 	}
 
 	config struct {
-		Debug   bool
-		Browser bool
-		Vpn     vpn
-		Server  server
+		Debug         bool
+		Browser       browser
+		Notifications bool
+		Vpn           vpn
+		Server        server
+		Dns           dns
+		Secrets       secrets
+		Hooks         map[string]string
+		Profiles      map[string]profile
 	}
 )
 
+// profile returns the settings for the named profile, empty if it has none.
+func (c *config) profile(name string) profile {
+	return c.Profiles[name]
+}
+
 func loadConfig(filename string) (c *config, err error) {
 	fileBytes, err := os.ReadFile(filename)
 
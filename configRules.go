@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	ruleDrop    = "drop"
+	ruleReplace = "replace"
+	ruleAppend  = "append"
+)
+
+type (
+	// configRule transforms the directives of the .ovpn file before it's handed to openvpn. drop and replace
+	// match directives by name and, if Value is set, their arguments. append adds Line at the end.
+	configRule struct {
+		Action    string
+		Directive string
+		Value     string
+		Line      string
+	}
+
+	// openVPNDirective is a single directive of an openvpn config, an inline <block> is one directive
+	// named after its tag. Comments and blank lines have no name.
+	openVPNDirective struct {
+		Name  string
+		Value string
+		Text  string
+	}
+)
+
+// defaultConfigRules drop everything the client passes to openvpn itself, that would make openvpn ask
+// for input it can't get or that would move its output away from us.
+var defaultConfigRules = []configRule{
+	{Action: ruleDrop, Directive: "auth-user-pass"},
+	{Action: ruleDrop, Directive: "auth-federate"},
+	{Action: ruleDrop, Directive: "auth-retry", Value: "interact"},
+	{Action: ruleDrop, Directive: "remote"},
+	{Action: ruleDrop, Directive: "remote-random-hostname"},
+	{Action: ruleDrop, Directive: "verb"},
+	{Action: ruleDrop, Directive: "log"},
+	{Action: ruleDrop, Directive: "log-append"},
+	{Action: ruleDrop, Directive: "syslog"},
+	{Action: ruleDrop, Directive: "daemon"},
+}
+
+// parseOpenVPNDirectives splits an openvpn config into its directives.
+func parseOpenVPNDirectives(fileBytes []byte) (directives []openVPNDirective, err error) {
+	var block *openVPNDirective
+
+	for _, line := range strings.Split(strings.TrimRight(string(fileBytes), "\r\n"), "\n") {
+		line = strings.TrimSpace(line)
+
+		if block != nil {
+			block.Text += "\n" + line
+
+			if line == "</"+block.Name+">" {
+				directives = append(directives, *block)
+				block = nil
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") && !strings.HasPrefix(line, "</") {
+			block = &openVPNDirective{Name: strings.Trim(line, "<>"), Text: line}
+			continue
+		}
+
+		d := openVPNDirective{Text: line}
+
+		// Comments and blank lines are kept as they are but never match a rule. Arguments can be separated
+		// by any run of spaces and tabs, the value is normalized to single spaces for matching.
+		if fields := strings.Fields(line); len(fields) > 0 && !isOpenVPNComment(line) {
+			d.Name = fields[0]
+			d.Value = strings.Join(fields[1:], " ")
+		}
+
+		directives = append(directives, d)
+	}
+
+	if block != nil {
+		return nil, fmt.Errorf("inline <%s> block is never closed", block.Name)
+	}
+
+	return
+}
+
+func isOpenVPNComment(line string) bool {
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+func (r configRule) matches(d openVPNDirective) bool {
+	return d.Name != "" && d.Name == r.Directive && (r.Value == "" || d.Value == strings.Join(strings.Fields(r.Value), " "))
+}
+
+func validateConfigRules(rules []configRule) error {
+	for _, r := range rules {
+		switch r.Action {
+		case ruleDrop:
+			if r.Directive == "" {
+				return fmt.Errorf("%s rule needs a directive", r.Action)
+			}
+		case ruleReplace:
+			if r.Directive == "" || r.Line == "" {
+				return fmt.Errorf("%s rule needs a directive and a line", r.Action)
+			}
+		case ruleAppend:
+			if r.Line == "" {
+				return fmt.Errorf("%s rule needs a line", r.Action)
+			}
+		default:
+			return fmt.Errorf("unknown rule action '%s', expected %s, %s or %s", r.Action, ruleDrop, ruleReplace, ruleAppend)
+		}
+	}
+
+	return nil
+}
+
+// applyConfigRules runs rules over the directives in order.
+func applyConfigRules(directives []openVPNDirective, rules []configRule) []openVPNDirective {
+	for _, r := range rules {
+		if r.Action == ruleAppend {
+			directives = append(directives, openVPNDirective{Text: r.Line})
+			continue
+		}
+
+		kept := directives[:0:0]
+
+		for _, d := range directives {
+			if !r.matches(d) {
+				kept = append(kept, d)
+			} else if r.Action == ruleReplace {
+				kept = append(kept, openVPNDirective{Text: r.Line})
+			}
+		}
+
+		directives = kept
+	}
+
+	return directives
+}
+
+// configRules are the default rules followed by the ones from the config, global first and then the profile's.
+func configRules(c *config, profile string) (rules []configRule, err error) {
+	rules = append(rules, defaultConfigRules...)
+	rules = append(rules, c.Vpn.Rules...)
+	rules = append(rules, c.profile(profile).Rules...)
+	err = validateConfigRules(rules)
+
+	return
+}
+
+// renderOpenVPNConfig returns the config openvpn gets for the given .ovpn file.
+func renderOpenVPNConfig(fileBytes []byte, rules []configRule) (string, error) {
+	directives, err := parseOpenVPNDirectives(fileBytes)
+
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+
+	for _, d := range applyConfigRules(directives, rules) {
+		rendered.WriteString(d.Text + "\n")
+	}
+
+	return rendered.String(), nil
+}
+
+func configRenderAction(c *cli.Context) error {
+	openVPNConfig := c.String("config")
+	profile := c.String("profile")
+
+	if openVPNConfig == "" && profile == "" {
+		return fmt.Errorf("either --config or the --profile of an imported config is required")
+	}
+
+	if profile == "" {
+		profile = profileNameFromConfig(openVPNConfig)
+	}
+
+	profile = sanitizeProfileName(profile)
+
+	awsclientConfig := &config{}
+
+	if filename, err := searchConfigFilename(); err == nil {
+		if awsclientConfig, err = loadConfig(filename); err != nil {
+			return err
+		}
+	}
+
+	if openVPNConfig == "" {
+		if openVPNConfig = awsclientConfig.profile(profile).Config; openVPNConfig == "" {
+			return fmt.Errorf("profile '%s' has no config, import an .ovpn file for it or pass --config", profile)
+		}
+	}
+
+	rules, err := configRules(awsclientConfig, profile)
+
+	if err != nil {
+		return err
+	}
+
+	fileBytes, err := os.ReadFile(openVPNConfig)
+
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderOpenVPNConfig(fileBytes, rules)
+
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("unsafe-debug") {
+		rendered = redact(rendered)
+	}
+
+	fmt.Print(rendered)
+
+	return nil
+}
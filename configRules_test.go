@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOpenVPNDirectives(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantName  string
+		wantValue string
+	}{
+		{name: "single space", line: "remote vpn.example.com 443", wantName: "remote", wantValue: "vpn.example.com 443"},
+		{name: "tab", line: "remote\tvpn.example.com 443", wantName: "remote", wantValue: "vpn.example.com 443"},
+		{name: "several spaces", line: "remote   vpn.example.com    443", wantName: "remote", wantValue: "vpn.example.com 443"},
+		{name: "indented", line: "\t auth-retry\tinteract", wantName: "auth-retry", wantValue: "interact"},
+		{name: "carriage return", line: "verb 3\r", wantName: "verb", wantValue: "3"},
+		{name: "no value", line: "auth-federate", wantName: "auth-federate"},
+		{name: "hash comment", line: "# remote vpn.example.com 443"},
+		{name: "semicolon comment", line: ";remote vpn.example.com 443"},
+		{name: "blank", line: "  \t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directives, err := parseOpenVPNDirectives([]byte(tt.line + "\n"))
+
+			if err != nil {
+				t.Fatalf("parseOpenVPNDirectives: %v", err)
+			}
+
+			if len(directives) != 1 {
+				t.Fatalf("got %d directives, want 1", len(directives))
+			}
+
+			if d := directives[0]; d.Name != tt.wantName || d.Value != tt.wantValue {
+				t.Errorf("got name %q value %q, want name %q value %q", d.Name, d.Value, tt.wantName, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestApplyConfigRules(t *testing.T) {
+	config := strings.Join([]string{
+		"client",
+		"# remote commented.example.com 443",
+		"remote\tcvpn-endpoint.example.com 443",
+		"auth-retry  interact",
+		"verb\t5",
+		"<ca>",
+		"-----BEGIN CERTIFICATE-----",
+		"-----END CERTIFICATE-----",
+		"</ca>",
+	}, "\n")
+
+	tests := []struct {
+		name    string
+		rules   []configRule
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults drop tab separated directives",
+			rules:   defaultConfigRules,
+			want:    []string{"client", "# remote commented.example.com 443", "<ca>"},
+			notWant: []string{"remote\t", "auth-retry", "verb"},
+		},
+		{
+			name:    "value matches whatever the whitespace",
+			rules:   []configRule{{Action: ruleReplace, Directive: "auth-retry", Value: "interact", Line: "auth-retry nointeract"}},
+			want:    []string{"auth-retry nointeract"},
+			notWant: []string{"auth-retry  interact"},
+		},
+		{
+			name:    "comments never match",
+			rules:   []configRule{{Action: ruleDrop, Directive: "#"}, {Action: ruleDrop, Directive: "remote"}},
+			want:    []string{"# remote commented.example.com 443"},
+			notWant: []string{"cvpn-endpoint.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directives, err := parseOpenVPNDirectives([]byte(config))
+
+			if err != nil {
+				t.Fatalf("parseOpenVPNDirectives: %v", err)
+			}
+
+			var lines []string
+
+			for _, d := range applyConfigRules(directives, tt.rules) {
+				lines = append(lines, strings.SplitN(d.Text, "\n", 2)[0])
+			}
+
+			rendered := strings.Join(lines, "\n")
+
+			for _, want := range tt.want {
+				if !strings.Contains(rendered, want) {
+					t.Errorf("rendered config is missing %q:\n%s", want, rendered)
+				}
+			}
+
+			for _, notWant := range tt.notWant {
+				if strings.Contains(rendered, notWant) {
+					t.Errorf("rendered config still has %q:\n%s", notWant, rendered)
+				}
+			}
+		})
+	}
+}
+
+func TestParseOpenVPNConfigWhitespace(t *testing.T) {
+	config, err := parseOpenVPNConfig([]byte("client\n#remote ignored.example.com 1194\nremote\tcvpn-endpoint.example.com   443\nproto\tudp\nauth-federate\n"))
+
+	if err != nil {
+		t.Fatalf("parseOpenVPNConfig: %v", err)
+	}
+
+	if config.Host != "cvpn-endpoint.example.com" || config.Port != 443 || config.Protocol != "udp" || config.AuthType != authSAML {
+		t.Errorf("got host %q port %d proto %q auth %q", config.Host, config.Port, config.Protocol, config.AuthType)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dnsModeAuto       = "auto"
+	dnsModeResolved   = "resolved"
+	dnsModeResolvconf = "resolvconf"
+	dnsModeOff        = "off"
+
+	resolvedDest      = "org.freedesktop.resolve1"
+	resolvedPath      = "/org/freedesktop/resolve1"
+	resolvedInterface = "org.freedesktop.resolve1.Manager"
+)
+
+type (
+	// pushedDNS holds the DNS related dhcp-options AWS pushes to the client.
+	pushedDNS struct {
+		Servers []string
+		Domains []string
+	}
+)
+
+// parseDHCPOption adds a single "dhcp-option TYPE VALUE" to d.
+func (d *pushedDNS) parseDHCPOption(option string) {
+	tokens := strings.Fields(option)
+
+	if len(tokens) != 3 || tokens[0] != "dhcp-option" {
+		return
+	}
+
+	switch tokens[1] {
+	case "DNS":
+		if net.ParseIP(tokens[2]) != nil {
+			d.Servers = append(d.Servers, tokens[2])
+		}
+	case "DOMAIN", "DOMAIN-SEARCH", "ADAPTER_DOMAIN_SUFFIX":
+		d.Domains = append(d.Domains, tokens[2])
+	}
+}
+
+// parseForeignOptions collects the DNS options openvpn hands its scripts as foreign_option_1, foreign_option_2, ...
+func parseForeignOptions(getenv func(string) string) (d pushedDNS) {
+	for i := 1; ; i++ {
+		option := getenv("foreign_option_" + strconv.Itoa(i))
+
+		if option == "" {
+			return
+		}
+
+		d.parseDHCPOption(option)
+	}
+}
+
+func (d pushedDNS) Empty() bool {
+	return len(d.Servers) == 0 && len(d.Domains) == 0
+}
+
+// detectDNSMode picks the DNS backend for mode "auto" (or unset): systemd-resolved when it's running,
+// resolvconf when it's installed, otherwise nothing.
+func detectDNSMode(mode string) string {
+	if mode != "" && mode != dnsModeAuto {
+		return mode
+	}
+
+	if fileExists("/run/systemd/resolve/io.systemd.Resolve") && commandExists("busctl") {
+		return dnsModeResolved
+	}
+
+	if commandExists("resolvconf") {
+		return dnsModeResolvconf
+	}
+
+	return dnsModeOff
+}
+
+// runPrivileged runs cmd as root, through sudo if we aren't root already.
+func runPrivileged(c *config, cmd *exec.Cmd) error {
+	wrapped := withSudo(c, cmd)
+
+	log.Debug().Str("command", wrapped.String()).Msg("Running DNS command")
+
+	out, err := wrapped.CombinedOutput()
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// resolvedLinkCommands builds busctl calls configuring the link with systemd-resolved. With split DNS
+// the pushed domains become routing-only domains and the link never becomes the default DNS route,
+// so only queries for those domains go through the tunnel.
+func resolvedLinkCommands(ifindex int, d pushedDNS, split bool) (commands [][]string) {
+	index := strconv.Itoa(ifindex)
+
+	if len(d.Servers) > 0 {
+		args := []string{"call", resolvedDest, resolvedPath, resolvedInterface, "SetLinkDNS", "ia(iay)", index, strconv.Itoa(len(d.Servers))}
+
+		for _, server := range d.Servers {
+			ip := net.ParseIP(server)
+
+			if ip4 := ip.To4(); ip4 != nil {
+				args = append(args, "2", "4")
+				ip = ip4
+			} else {
+				args = append(args, "10", "16")
+			}
+
+			for _, b := range ip {
+				args = append(args, strconv.Itoa(int(b)))
+			}
+		}
+
+		commands = append(commands, args)
+	}
+
+	if len(d.Domains) > 0 {
+		args := []string{"call", resolvedDest, resolvedPath, resolvedInterface, "SetLinkDomains", "ia(sb)", index, strconv.Itoa(len(d.Domains))}
+
+		for _, domain := range d.Domains {
+			args = append(args, domain, strconv.FormatBool(split))
+		}
+
+		commands = append(commands, args)
+	}
+
+	commands = append(commands, []string{"call", resolvedDest, resolvedPath, resolvedInterface, "SetLinkDefaultRoute", "ib", index, strconv.FormatBool(!split || len(d.Domains) == 0)})
+
+	return
+}
+
+func resolvconfRecord(device string) string {
+	return device + ".openvpn"
+}
+
+// applyDNS configures the pushed DNS settings for device.
+func applyDNS(c *config, device string, d pushedDNS) error {
+	mode := detectDNSMode(c.Dns.Mode)
+
+	if mode == dnsModeOff || d.Empty() {
+		return nil
+	}
+
+	log.Info().Str("mode", mode).Str("device", device).Strs("servers", d.Servers).Strs("domains", d.Domains).Msg("Configuring DNS")
+
+	switch mode {
+	case dnsModeResolved:
+		iface, err := net.InterfaceByName(device)
+
+		if err != nil {
+			return err
+		}
+
+		for _, args := range resolvedLinkCommands(iface.Index, d, c.Dns.Split) {
+			if err = runPrivileged(c, exec.Command("busctl", args...)); err != nil {
+				return err
+			}
+		}
+
+	case dnsModeResolvconf:
+		var conf strings.Builder
+
+		for _, server := range d.Servers {
+			conf.WriteString("nameserver " + server + "\n")
+		}
+
+		if len(d.Domains) > 0 {
+			conf.WriteString("search " + strings.Join(d.Domains, " ") + "\n")
+		}
+
+		cmd := exec.Command("resolvconf", "-a", resolvconfRecord(device))
+		cmd.Stdin = strings.NewReader(conf.String())
+
+		return runPrivileged(c, cmd)
+
+	default:
+		return fmt.Errorf("unknown dns mode '%s', expected auto, resolved, resolvconf or off", mode)
+	}
+
+	return nil
+}
+
+// revertDNS undoes applyDNS for device.
+func revertDNS(c *config, device string) error {
+	switch detectDNSMode(c.Dns.Mode) {
+	case dnsModeResolved:
+		iface, err := net.InterfaceByName(device)
+
+		// The link is usually gone with the tunnel, which already dropped its DNS settings.
+		if err != nil {
+			return nil
+		}
+
+		return runPrivileged(c, exec.Command("busctl", "call", resolvedDest, resolvedPath, resolvedInterface, "RevertLink", "i", strconv.Itoa(iface.Index)))
+
+	case dnsModeResolvconf:
+		return runPrivileged(c, exec.Command("resolvconf", "-d", resolvconfRecord(device)))
+	}
+
+	return nil
+}
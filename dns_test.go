@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseForeignOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		servers []string
+		domains []string
+	}{
+		{
+			name: "servers and domains",
+			env: map[string]string{
+				"foreign_option_1": "dhcp-option DNS 10.1.0.2",
+				"foreign_option_2": "dhcp-option DNS fd00::53",
+				"foreign_option_3": "dhcp-option DOMAIN corp.internal",
+				"foreign_option_4": "dhcp-option DOMAIN-SEARCH eu.corp.internal",
+				"foreign_option_5": "dhcp-option ADAPTER_DOMAIN_SUFFIX aws.corp.internal",
+			},
+			servers: []string{"10.1.0.2", "fd00::53"},
+			domains: []string{"corp.internal", "eu.corp.internal", "aws.corp.internal"},
+		},
+		{
+			name: "ignores other options and invalid servers",
+			env: map[string]string{
+				"foreign_option_1": "dhcp-option NTP 10.1.0.3",
+				"foreign_option_2": "dhcp-option DNS not-an-ip",
+				"foreign_option_3": "dhcp-option DNS",
+				"foreign_option_4": "dhcp-option DNS 10.1.0.2 extra",
+				"foreign_option_5": "route 10.1.0.0 255.255.0.0",
+				"foreign_option_6": "dhcp-option  DNS\t10.1.0.2",
+			},
+			servers: []string{"10.1.0.2"},
+		},
+		{
+			name: "stops at the first missing option",
+			env: map[string]string{
+				"foreign_option_1": "dhcp-option DNS 10.1.0.2",
+				"foreign_option_3": "dhcp-option DNS 10.1.0.3",
+			},
+			servers: []string{"10.1.0.2"},
+		},
+		{
+			name: "nothing pushed",
+			env:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := parseForeignOptions(func(name string) string { return tt.env[name] })
+
+			if !reflect.DeepEqual(d.Servers, tt.servers) || !reflect.DeepEqual(d.Domains, tt.domains) {
+				t.Errorf("got servers %q domains %q, want servers %q domains %q", d.Servers, d.Domains, tt.servers, tt.domains)
+			}
+
+			if d.Empty() != (len(tt.servers) == 0 && len(tt.domains) == 0) {
+				t.Errorf("Empty() = %v", d.Empty())
+			}
+		})
+	}
+}
+
+func TestResolvedLinkCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		dns   pushedDNS
+		split bool
+		want  [][]string
+	}{
+		{
+			name: "servers and domains",
+			dns:  pushedDNS{Servers: []string{"10.1.0.2", "fd00::53"}, Domains: []string{"corp.internal"}},
+			want: [][]string{
+				{"SetLinkDNS", "ia(iay)", "7", "2", "2", "4", "10", "1", "0", "2", "10", "16", "253", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "83"},
+				{"SetLinkDomains", "ia(sb)", "7", "1", "corp.internal", "false"},
+				{"SetLinkDefaultRoute", "ib", "7", "true"},
+			},
+		},
+		{
+			name:  "split DNS routes only the pushed domains",
+			dns:   pushedDNS{Servers: []string{"10.1.0.2"}, Domains: []string{"corp.internal", "eu.corp.internal"}},
+			split: true,
+			want: [][]string{
+				{"SetLinkDNS", "ia(iay)", "7", "1", "2", "4", "10", "1", "0", "2"},
+				{"SetLinkDomains", "ia(sb)", "7", "2", "corp.internal", "true", "eu.corp.internal", "true"},
+				{"SetLinkDefaultRoute", "ib", "7", "false"},
+			},
+		},
+		{
+			name:  "split DNS without domains stays the default route",
+			dns:   pushedDNS{Servers: []string{"10.1.0.2"}},
+			split: true,
+			want: [][]string{
+				{"SetLinkDNS", "ia(iay)", "7", "1", "2", "4", "10", "1", "0", "2"},
+				{"SetLinkDefaultRoute", "ib", "7", "true"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolvedLinkCommands(7, tt.dns, tt.split)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d commands, want %d: %q", len(got), len(tt.want), got)
+			}
+
+			for i, want := range tt.want {
+				want = append([]string{"call", "org.freedesktop.resolve1", "/org/freedesktop/resolve1", "org.freedesktop.resolve1.Manager"}, want...)
+
+				if !reflect.DeepEqual(got[i], want) {
+					t.Errorf("command %d =\n%q\nwant\n%q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
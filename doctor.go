@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// Stock openvpn reads config lines into a 256 byte buffer. The AWS patch raises it to 128KB,
+	// so any line comfortably above the stock limit tells the two builds apart.
+	openVPNProbeLineLength = 4096
+)
+
+type (
+	doctorCheck struct {
+		Name   string `json:"name"`
+		OK     bool   `json:"ok"`
+		Detail string `json:"detail"`
+	}
+)
+
+var openVPNVersionRegex = regexp.MustCompile(`OpenVPN (\d+\.\d+\.\d+)`)
+
+// openVPNVersion runs `openvpn --version` and returns the reported version.
+func openVPNVersion(binary string) (version string, err error) {
+	out, err := exec.Command(binary, "--version").CombinedOutput()
+
+	// openvpn --version exits with status 1 on some builds, so only fail when nothing was printed.
+	matches := openVPNVersionRegex.FindStringSubmatch(string(out))
+
+	if len(matches) < 2 {
+		if err == nil {
+			err = fmt.Errorf("unrecognized version output")
+		}
+
+		return
+	}
+
+	return matches[1], nil
+}
+
+// probeOpenVPNPatched feeds openvpn a config line longer than stock builds accept.
+// A patched binary parses it and prints its version, a stock binary fails with an options error.
+func probeOpenVPNPatched(binary string) (patched bool, err error) {
+	f, err := os.CreateTemp("", "*.probe.openvpn")
+
+	if err != nil {
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("setenv AWS_VPN_CLIENT_PROBE " + strings.Repeat("a", openVPNProbeLineLength) + "\n")
+	f.Close()
+
+	if err != nil {
+		return
+	}
+
+	out, runErr := exec.Command(binary, "--config", f.Name(), "--version").CombinedOutput()
+
+	log.Debug().Str("binary", binary).Bytes("out", out).Msg("Probed openvpn buffer limits")
+
+	if strings.Contains(string(out), "Options error") {
+		return false, nil
+	}
+
+	if !openVPNVersionRegex.Match(out) {
+		if runErr == nil {
+			runErr = fmt.Errorf("unexpected probe output")
+		}
+
+		return false, runErr
+	}
+
+	return true, nil
+}
+
+// verifyOpenVPNBinary returns an error describing why binary can't be used to connect to AWS.
+func verifyOpenVPNBinary(binary string) error {
+	if binary == "" {
+		return fmt.Errorf("vpn.openvpn is not set")
+	}
+
+	if !fileExists(binary) {
+		return fmt.Errorf("openvpn binary '%s' not found", binary)
+	}
+
+	if _, err := openVPNVersion(binary); err != nil {
+		return fmt.Errorf("failed running '%s --version': %w", binary, err)
+	}
+
+	patched, err := probeOpenVPNPatched(binary)
+
+	if err != nil {
+		return fmt.Errorf("failed probing '%s': %w", binary, err)
+	}
+
+	if !patched {
+		return fmt.Errorf("openvpn binary '%s' is not patched for AWS, please build one with the setup command", binary)
+	}
+
+	return nil
+}
+
+func runDoctorChecks() (checks []doctorCheck) {
+	configFilename, err := searchConfigFilename()
+
+	if err != nil {
+		return append(checks, doctorCheck{Name: "config", Detail: defaultConfigFilename + " not found in working directory or user config folder"})
+	}
+
+	c, err := loadConfig(configFilename)
+
+	if err != nil {
+		return append(checks, doctorCheck{Name: "config", Detail: err.Error()})
+	}
+
+	checks = append(checks, doctorCheck{Name: "config", OK: true, Detail: configFilename})
+
+	version, err := openVPNVersion(c.Vpn.OpenVPN)
+
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "openvpn", Detail: err.Error()})
+	} else {
+		checks = append(checks, doctorCheck{Name: "openvpn", OK: true, Detail: c.Vpn.OpenVPN + " (" + version + ")"})
+	}
+
+	err = verifyOpenVPNBinary(c.Vpn.OpenVPN)
+
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "patched", Detail: err.Error()})
+	} else {
+		checks = append(checks, doctorCheck{Name: "patched", OK: true, Detail: "buffer limits raised"})
+	}
+
+	return
+}
+
+// doctorAction checks the local environment for everything needed to establish a tunnel.
+func doctorAction(c *cli.Context) error {
+	var failed bool
+
+	for _, check := range runDoctorChecks() {
+		status := "ok"
+
+		if !check.OK {
+			status = "FAIL"
+			failed = true
+		}
+
+		fmt.Printf("%-10s %-5s %s\n", check.Name, status, check.Detail)
+	}
+
+	if failed {
+		return fmt.Errorf("one or more checks failed")
+	}
+
+	return nil
+}
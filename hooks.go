@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	hookPreConnect   = "pre-connect"
+	hookAuthURLReady = "auth-url-ready"
+	hookConnected    = "connected"
+	hookDisconnected = "disconnected"
+	hookReconnecting = "reconnecting"
+	hookAuthFailed   = "auth-failed"
+
+	hookShell = "/bin/sh"
+)
+
+var hookEvents = []string{
+	hookPreConnect,
+	hookAuthURLReady,
+	hookConnected,
+	hookDisconnected,
+	hookReconnecting,
+	hookAuthFailed,
+}
+
+// detectOpenVPNEvent maps an openvpn log line to the lifecycle event it signals, if any.
+func detectOpenVPNEvent(line string) string {
+	switch {
+	case strings.Contains(line, "Initialization Sequence Completed"):
+		return hookConnected
+	case strings.Contains(line, "AUTH_FAILED"):
+		return hookAuthFailed
+	case strings.Contains(line, "process restarting"), strings.Contains(line, "Restart pause"):
+		return hookReconnecting
+	}
+
+	return ""
+}
+
+// validateHooks warns about hooks configured for events we never fire, most likely typos.
+func validateHooks(hooks map[string]string) {
+	for event := range hooks {
+		known := false
+
+		for _, e := range hookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			log.Warn().Str("event", event).Strs("events", hookEvents).Msg("Ignoring hook for unknown event")
+		}
+	}
+}
+
+// hookEnv describes the session to hook commands.
+func hookEnv(event string, state sessionState) []string {
+	return []string{
+		"AWS_VPN_EVENT=" + event,
+		"AWS_VPN_PROFILE=" + state.Profile,
+		"AWS_VPN_ENDPOINT=" + state.EndpointHost,
+		"AWS_VPN_ENDPOINT_IP=" + state.EndpointIP,
+		"AWS_VPN_TUN_DEVICE=" + state.TunDevice,
+		"AWS_VPN_TUN_IP=" + state.AssignedIP,
+		"AWS_VPN_ROUTES=" + strings.Join(state.Routes, " "),
+	}
+}
+
+// runHook runs the command configured for event as the invoking (non-root) user. pre-connect hooks are
+// waited for so they can prepare the system, everything else runs in the background.
+func runHook(c *config, event string, state sessionState, extraEnv ...string) {
+	command, ok := c.Hooks[event]
+
+	if !ok || command == "" {
+		return
+	}
+
+	cmd, err := commandAsNonRoot(c.Vpn.User, hookShell, "-c", command)
+
+	if err != nil {
+		log.Warn().Err(err).Str("event", event).Msg("Failed preparing hook")
+		return
+	}
+
+	cmd.Env = append(append(cmd.Env, hookEnv(event, state)...), extraEnv...)
+
+	log.Debug().Str("event", event).Str("command", command).Msg("Running hook")
+
+	if event == hookPreConnect {
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Warn().Err(err).Str("event", event).Bytes("out", out).Msg("Hook failed")
+		}
+
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		log.Warn().Err(err).Str("event", event).Msg("Failed starting hook")
+		return
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Warn().Err(err).Str("event", event).Msg("Hook failed")
+		}
+	}()
+}
+
+// announceEvent runs the hook configured for event and, if enabled, shows a desktop notification for it.
+func announceEvent(c *config, event string, state sessionState, extraEnv ...string) {
+	runHook(c, event, state, extraEnv...)
+
+	if !c.Notifications {
+		return
+	}
+
+	wasConnected := event != hookConnected && state.ConnectedSince != nil
+
+	if summary, body := notificationForEvent(event, state, wasConnected); summary != "" {
+		sendNotification(c, summary, body)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+var profilesKeyRegex = regexp.MustCompile(`^profiles:\s*(#.*)?$`)
+
+// validateImportedConfig makes sure the file is an openvpn client config we can connect with.
+func validateImportedConfig(fileBytes []byte) (connectionConfig *openVPNConfig, err error) {
+	directives, err := parseOpenVPNDirectives(fileBytes)
+
+	if err != nil {
+		return
+	}
+
+	connectionConfig, err = parseOpenVPNConfig(fileBytes)
+
+	if err != nil {
+		return
+	}
+
+	if connectionConfig.Host == "" {
+		return nil, fmt.Errorf("no remote found, is this an openvpn client configuration?")
+	}
+
+	for _, d := range directives {
+		if d.Name == "ca" {
+			return
+		}
+	}
+
+	return nil, fmt.Errorf("no ca found, is this an openvpn client configuration?")
+}
+
+// lineDiff returns the lines removed from and added to old to get new, prefixed with - and +.
+func lineDiff(old, new []string) (diff []string) {
+	// Longest common subsequence, configs are small enough for the quadratic table.
+	lcs := make([][]int, len(old)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+old[i])
+			i++
+		default:
+			diff = append(diff, "+ "+new[j])
+			j++
+		}
+	}
+
+	for ; i < len(old); i++ {
+		diff = append(diff, "- "+old[i])
+	}
+
+	for ; j < len(new); j++ {
+		diff = append(diff, "+ "+new[j])
+	}
+
+	return
+}
+
+// addProfileToConfig adds a profile entry to the config file, creating it if needed. The entry is inserted
+// as text so comments and formatting of the rest of the file survive.
+func addProfileToConfig(filename, name string, p profile) error {
+	entry, err := yaml.Marshal(yaml.MapSlice{{Key: name, Value: yaml.MapSlice{
+		{Key: "config", Value: p.Config},
+		{Key: "auth", Value: p.Auth},
+	}}})
+
+	if err != nil {
+		return err
+	}
+
+	var indented strings.Builder
+
+	for _, line := range strings.Split(strings.TrimRight(string(entry), "\n"), "\n") {
+		indented.WriteString("  " + line + "\n")
+	}
+
+	content, err := os.ReadFile(filename)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	inserted := false
+
+	for i, line := range lines {
+		if profilesKeyRegex.MatchString(line) {
+			lines[i] = line + "\n" + strings.TrimRight(indented.String(), "\n")
+			inserted = true
+			break
+		}
+	}
+
+	if !inserted {
+		if strings.Contains(string(content), "\nprofiles:") || strings.HasPrefix(string(content), "profiles:") {
+			return fmt.Errorf("can't add profile to the profiles section of %s, please add it by hand:\n%s", filename, indented.String())
+		}
+
+		lines = append(lines, "profiles:", strings.TrimRight(indented.String(), "\n"))
+	}
+
+	updated := strings.TrimLeft(strings.Join(lines, "\n"), "\n") + "\n"
+
+	return os.WriteFile(filename, []byte(updated), 0600)
+}
+
+func importAction(c *cli.Context) error {
+	source := c.Args().First()
+
+	if source == "" {
+		return fmt.Errorf("missing .ovpn file to import")
+	}
+
+	// cli stops parsing flags at the file, anything after it would be silently ignored.
+	if c.Args().Len() > 1 {
+		return fmt.Errorf("unexpected argument '%s', flags go before the file: import --name prod file.ovpn", c.Args().Get(1))
+	}
+
+	name := c.String("name")
+
+	if name == "" {
+		name = profileNameFromConfig(source)
+	}
+
+	name = sanitizeProfileName(name)
+
+	fileBytes, err := os.ReadFile(source)
+
+	if err != nil {
+		return err
+	}
+
+	connectionConfig, err := validateImportedConfig(fileBytes)
+
+	if err != nil {
+		return fmt.Errorf("invalid openvpn configuration %s: %w", source, err)
+	}
+
+	configDir, err := getHomeDirConfigPath()
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+
+	imported := profile{
+		Config: path.Join(configDir, name+".ovpn"),
+		Auth:   connectionConfig.AuthType,
+	}
+
+	if previous, err := os.ReadFile(imported.Config); err == nil {
+		before, after := string(previous), string(fileBytes)
+
+		if !c.Bool("unsafe-debug") {
+			before, after = redact(before), redact(after)
+		}
+
+		diff := lineDiff(strings.Split(strings.TrimRight(before, "\n"), "\n"), strings.Split(strings.TrimRight(after, "\n"), "\n"))
+
+		switch {
+		case string(previous) == string(fileBytes):
+			fmt.Printf("Profile %s is unchanged.\n", name)
+		case len(diff) == 0:
+			fmt.Printf("Updating profile %s, only redacted key material changed. Use --unsafe-debug to see it.\n", name)
+		default:
+			fmt.Printf("Updating profile %s:\n%s\n", name, strings.Join(diff, "\n"))
+		}
+	}
+
+	if err = writeFileAtomic(imported.Config, fileBytes, 0600); err != nil {
+		return err
+	}
+
+	configFilename, err := searchConfigFilename()
+
+	if err != nil {
+		configFilename = path.Join(configDir, defaultConfigFilename)
+	}
+
+	awsclientConfig := &config{}
+
+	if fileExists(configFilename) {
+		if awsclientConfig, err = loadConfig(configFilename); err != nil {
+			return err
+		}
+	}
+
+	existing, ok := awsclientConfig.Profiles[name]
+
+	switch {
+	case !ok:
+		if err = addProfileToConfig(configFilename, name, imported); err != nil {
+			return err
+		}
+	case existing.Config != imported.Config || existing.Auth != imported.Auth:
+		log.Warn().
+			Str("profile", name).
+			Str("config", imported.Config).
+			Str("auth", imported.Auth).
+			Msg("Profile already exists in " + configFilename + " with different settings, please update its config and auth by hand")
+	}
+
+	fmt.Printf("Imported %s as profile %s (%s auth), connect with: %s serve --profile %s\n", source, name, imported.Auth, os.Args[0], name)
+
+	return nil
+}
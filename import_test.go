@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []string
+		new  []string
+		want []string
+	}{
+		{
+			name: "unchanged",
+			old:  []string{"client", "remote vpn.example.com 443"},
+			new:  []string{"client", "remote vpn.example.com 443"},
+		},
+		{
+			name: "changed line",
+			old:  []string{"client", "remote old.example.com 443", "proto udp"},
+			new:  []string{"client", "remote new.example.com 443", "proto udp"},
+			want: []string{"- remote old.example.com 443", "+ remote new.example.com 443"},
+		},
+		{
+			name: "added and removed lines",
+			old:  []string{"client", "auth-retry interact", "<ca>", "OLD", "</ca>"},
+			new:  []string{"client", "<ca>", "NEW", "</ca>", "reneg-sec 0"},
+			want: []string{"- auth-retry interact", "- OLD", "+ NEW", "+ reneg-sec 0"},
+		},
+		{
+			name: "from nothing",
+			new:  []string{"client", "dev tun"},
+			want: []string{"+ client", "+ dev tun"},
+		},
+		{
+			name: "to nothing",
+			old:  []string{"client", "dev tun"},
+			want: []string{"- client", "- dev tun"},
+		},
+		{
+			name: "moved line",
+			old:  []string{"a", "b", "c"},
+			new:  []string{"b", "c", "a"},
+			want: []string{"- a", "+ a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineDiff =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
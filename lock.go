@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	profileLockSuffix = ".lock"
+)
+
+type (
+	// profileLockedError is returned when another process holds a profile's lock.
+	profileLockedError struct {
+		Profile string
+		Pid     int
+	}
+)
+
+func (e *profileLockedError) Error() string {
+	return fmt.Sprintf("profile '%s' is already running (pid %d), stop it first or use --force", e.Profile, e.Pid)
+}
+
+// acquireProfileLock takes an exclusive flock on the profile's lock file in the runtime dir and records
+// our pid in it. The lock is held until the returned file is closed or the process exits.
+func acquireProfileLock(profile string) (lock *os.File, err error) {
+	dir, err := getRuntimeDir()
+
+	if err != nil {
+		return
+	}
+
+	lock, err = os.OpenFile(path.Join(dir, sanitizeProfileName(profile)+profileLockSuffix), os.O_CREATE|os.O_RDWR, 0600)
+
+	if err != nil {
+		return
+	}
+
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+	if err == syscall.EWOULDBLOCK {
+		content, _ := io.ReadAll(lock)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		lock.Close()
+
+		return nil, &profileLockedError{Profile: profile, Pid: pid}
+	} else if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	if err = lock.Truncate(0); err == nil {
+		_, err = lock.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// forceProfileLock stops whichever session holds the profile's lock and takes it over.
+func forceProfileLock(c *config, profile string, timeout time.Duration) (lock *os.File, err error) {
+	lock, err = acquireProfileLock(profile)
+
+	lockedErr, ok := err.(*profileLockedError)
+
+	if !ok {
+		return
+	}
+
+	state, stateErr := findSessionState(profile)
+
+	if stateErr == nil && state.Pid == lockedErr.Pid {
+		err = stopSession(c, state, timeout)
+	} else if err = syscall.Kill(lockedErr.Pid, syscall.SIGTERM); err == nil {
+		// No tunnel was brought up yet, the process cleans up on its own.
+		waitForProcessExit(lockedErr.Pid, timeout)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed stopping existing session (pid %d): %w", lockedErr.Pid, err)
+	}
+
+	return acquireProfileLock(profile)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+type (
+	// rotatingFileWriter is an io.Writer that appends to a file and rotates it once it grows past MaxSize.
+	// Rotated files are renamed to filename.1, filename.2, ... keeping at most MaxBackups of them.
+	rotatingFileWriter struct {
+		Filename   string
+		MaxSize    int64
+		MaxBackups int
+
+		mu   sync.Mutex
+		file *os.File
+		size int64
+	}
+)
+
+func newRotatingFileWriter(filename string, maxSize int64, maxBackups int) (w *rotatingFileWriter, err error) {
+	w = &rotatingFileWriter{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+
+	err = w.open()
+
+	return
+}
+
+func (w *rotatingFileWriter) open() error {
+	f, err := os.OpenFile(w.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+
+	return nil
+}
+
+func (w *rotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	// Backups that don't exist yet are skipped, anything else would overwrite the next one.
+	for i := w.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(w.Filename+"."+strconv.Itoa(i), w.Filename+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if w.MaxBackups > 0 {
+		if err := os.Rename(w.Filename, w.Filename+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.Filename); err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+func (w *rotatingFileWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.MaxSize > 0 && w.size+int64(len(p)) > w.MaxSize && w.size > 0 {
+		if err = w.rotate(); err != nil {
+			return
+		}
+	}
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+
+	return
+}
+
+const (
+	sessionLogFilename = "last-session.log"
+)
+
+// logWriter is the writer the global logger was configured with, so more outputs can be attached later.
+var logWriter io.Writer = os.Stderr
+
+// setupLogging configures the global logger from the app level --log-* flags.
+func setupLogging(c *cli.Context) error {
+	level, err := zerolog.ParseLevel(c.String("log-level"))
+
+	if err != nil {
+		return fmt.Errorf("invalid log level '%s'", c.String("log-level"))
+	}
+
+	zerolog.SetGlobalLevel(level)
+
+	var out io.Writer = os.Stderr
+
+	if filename := c.String("log-file"); filename != "" {
+		out, err = newRotatingFileWriter(filename, int64(c.Int("log-max-size"))*1024*1024, c.Int("log-max-backups"))
+
+		if err != nil {
+			return fmt.Errorf("failed opening log file: %w", err)
+		}
+	}
+
+	// Keep colors for the terminal only, escape codes are noise in a file.
+	_, isFile := out.(*rotatingFileWriter)
+
+	if !c.Bool("unsafe-debug") {
+		out = &redactingWriter{Out: out}
+	}
+
+	switch c.String("log-format") {
+	case "json":
+		logWriter = out
+	case "console":
+		logWriter = zerolog.ConsoleWriter{Out: out, NoColor: isFile}
+	default:
+		return fmt.Errorf("invalid log format '%s', expected json or console", c.String("log-format"))
+	}
+
+	log.Logger = zerolog.New(logWriter).With().Timestamp().Logger().Hook(fatalCleanupHook{})
+
+	if c.Bool("unsafe-debug") {
+		log.Warn().Msg("Redaction is disabled! Logs may contain SAML assertions, passwords and keys, don't share them.")
+	}
+
+	return nil
+}
+
+// startSessionLog copies everything logged from now on into the user config folder as redacted JSON,
+// replacing the previous session's log. The bundle command picks it up for bug reports. Under sudo the
+// log goes to the invoking user's config folder and belongs to them, so bundle can read it without sudo.
+func startSessionLog(defaultUser string) (filename string, err error) {
+	dir, owner, err := getUserConfigPath(defaultUser)
+
+	if err != nil {
+		return
+	}
+
+	if err = mkdirAllAsUser(dir, 0700, owner); err != nil {
+		return
+	}
+
+	filename = path.Join(dir, sessionLogFilename)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return
+	}
+
+	if err = chownToUser(filename, owner); err != nil {
+		f.Close()
+		return
+	}
+
+	log.Logger = log.Logger.Output(zerolog.MultiLevelWriter(logWriter, &redactingWriter{Out: f}))
+
+	return
+}
+
+// logOpenVPNOutput forwards openvpn output into our logger line by line until r is closed.
+// Lines that mark tunnel state changes are also logged as events for log shippers.
+// onLine, if set, sees every line so callers can react to openvpn's progress.
+func logOpenVPNOutput(r io.Reader, onLine func(string)) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		log.Info().Str("source", "openvpn").Msg(line)
+
+		switch detectOpenVPNEvent(line) {
+		case hookConnected:
+			log.Info().Str("event", hookConnected).Msg("OpenVPN tunnel is up.")
+		case hookReconnecting:
+			log.Warn().Str("event", hookReconnecting).Msg("OpenVPN tunnel is reconnecting.")
+		case hookAuthFailed:
+			log.Error().Str("event", hookAuthFailed).Msg("OpenVPN authentication failed.")
+		}
+
+		if onLine != nil {
+			onLine(line)
+		}
+	}
+}
+
+// runWithOpenVPNLogging starts cmd with its stdout/stderr parsed into our logger and waits for it to exit.
+// It returns cmd.Wait's error once cmd ran, an *exec.ExitError when it exited non-zero, and any other
+// error when cmd couldn't be started. onStart receives the process once it's running and nil once it exited.
+func runWithOpenVPNLogging(cmd *exec.Cmd, onStart func(*os.Process), onLine func(string)) error {
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	if onStart != nil {
+		onStart(cmd.Process)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		logOpenVPNOutput(stdout, onLine)
+	}()
+
+	go func() {
+		defer wg.Done()
+		logOpenVPNOutput(stderr, onLine)
+	}()
+
+	// Pipes must be drained before Wait closes them.
+	wg.Wait()
+
+	err = cmd.Wait()
+
+	if onStart != nil {
+		onStart(nil)
+	}
+
+	log.Info().Err(err).Str("event", hookDisconnected).Msg("OpenVPN tunnel closed.")
+
+	return err
+}
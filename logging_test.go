@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileWriter(t *testing.T) {
+	filename := path.Join(t.TempDir(), "client.log")
+	w, err := newRotatingFileWriter(filename, 10, 2)
+
+	if err != nil {
+		t.Fatalf("newRotatingFileWriter: %v", err)
+	}
+
+	defer w.file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write %q: %v", line, err)
+		}
+	}
+
+	for name, want := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n"} {
+		if got, err := os.ReadFile(filename + name); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", path.Base(filename+name), got, err, want)
+		}
+	}
+
+	if fileExists(filename + ".3") {
+		t.Error("kept more than MaxBackups backups")
+	}
+}
+
+func TestRotatingFileWriterRenameFailure(t *testing.T) {
+	filename := path.Join(t.TempDir(), "client.log")
+	w, err := newRotatingFileWriter(filename, 10, 2)
+
+	if err != nil {
+		t.Fatalf("newRotatingFileWriter: %v", err)
+	}
+
+	defer w.file.Close()
+
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err = w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write %q: %v", line, err)
+		}
+	}
+
+	// A non-empty directory in the way of client.log.2 makes renaming client.log.1 fail.
+	if err = os.MkdirAll(path.Join(filename+".2", "blocker"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("third\n")); err == nil {
+		t.Fatal("Write rotated over a backup that couldn't be moved")
+	}
+
+	if got, _ := os.ReadFile(filename + ".1"); !strings.Contains(string(got), "first") {
+		t.Errorf("client.log.1 = %q, want the first backup left alone", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// openVPNManagement hands credentials to openvpn over its management interface so they never touch disk.
+	// openvpn runs with --management-client and connects to a unix socket we listen on inside the private
+	// session directory, which means only we and root can reach it, even when openvpn runs through sudo.
+	openVPNManagement struct {
+		Socket string
+
+		listener net.Listener
+		mu       sync.Mutex
+		conn     net.Conn
+		closed   bool
+	}
+)
+
+func listenForManagement(dir string) (m *openVPNManagement, err error) {
+	token, err := generateRandomToken(4)
+
+	if err != nil {
+		return
+	}
+
+	socket := path.Join(dir, "mgmt-"+token+".sock")
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		return
+	}
+
+	if err = os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return
+	}
+
+	return &openVPNManagement{Socket: socket, listener: listener}, nil
+}
+
+// Args returns the openvpn options that make it ask us for its username and password.
+func (m *openVPNManagement) Args() []string {
+	return []string{
+		"--management", m.Socket, "unix",
+		"--management-client",
+		"--management-query-passwords",
+		"--auth-user-pass",
+	}
+}
+
+// quoteManagementString quotes s for use as a management command parameter.
+func quoteManagementString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return `"` + s + `"`
+}
+
+// ServeCredentials waits for openvpn to connect and answers its 'Auth' password queries until the
+// connection or the listener is closed. It blocks, so run it in its own goroutine.
+func (m *openVPNManagement) ServeCredentials(username, password string) error {
+	conn, err := m.listener.Accept()
+
+	if err != nil {
+		m.mu.Lock()
+		closed := m.closed
+		m.mu.Unlock()
+
+		// openvpn exited before asking us anything.
+		if closed {
+			return nil
+		}
+
+		return err
+	}
+
+	m.mu.Lock()
+	m.conn = conn
+	m.mu.Unlock()
+
+	log.Debug().Str("socket", m.Socket).Msg("openvpn connected to management interface")
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		log.Trace().Str("source", "management").Msg(line)
+
+		if !strings.HasPrefix(line, ">PASSWORD:Need 'Auth'") {
+			continue
+		}
+
+		log.Debug().Msg("openvpn requested credentials over management interface")
+
+		_, err = fmt.Fprintf(conn, "username \"Auth\" %s\npassword \"Auth\" %s\n",
+			quoteManagementString(username),
+			quoteManagementString(password))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close stops listening and drops the connection to openvpn, if there is one.
+func (m *openVPNManagement) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	m.closed = true
+	m.listener.Close()
+
+	if m.conn != nil {
+		m.conn.Close()
+	}
+
+	os.Remove(m.Socket)
+}
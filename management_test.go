@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOpenVPNManagement plays openvpn's side of the management interface: it connects to m, sends
+// lines and returns everything it got back once ServeCredentials is done.
+func fakeOpenVPNManagement(t *testing.T, m *openVPNManagement, username, password string, lines []string) string {
+	t.Helper()
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- m.ServeCredentials(username, password)
+	}()
+
+	conn, err := net.Dial("unix", m.Socket)
+
+	if err != nil {
+		t.Fatalf("connecting to management socket: %v", err)
+	}
+
+	defer conn.Close()
+
+	for _, line := range lines {
+		if _, err = io.WriteString(conn, line+"\n"); err != nil {
+			t.Fatalf("writing %q: %v", line, err)
+		}
+	}
+
+	// Hanging up our sending side ends ServeCredentials' read loop like openvpn exiting would.
+	conn.(*net.UnixConn).CloseWrite()
+
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Fatalf("ServeCredentials: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeCredentials didn't return after openvpn hung up")
+	}
+
+	m.Close()
+
+	got, err := io.ReadAll(conn)
+
+	if err != nil {
+		t.Fatalf("reading answers: %v", err)
+	}
+
+	return string(got)
+}
+
+func TestServeCredentials(t *testing.T) {
+	const answer = "username \"Auth\" \"N/A\"\npassword \"Auth\" \"ACS::35001\"\n"
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		lines    []string
+		want     string
+	}{
+		{
+			name:     "answers auth query",
+			username: "N/A",
+			password: "ACS::35001",
+			lines: []string{
+				">INFO:OpenVPN Management Interface Version 3 -- type 'help' for more info",
+				">PASSWORD:Need 'Auth' username/password",
+			},
+			want: answer,
+		},
+		{
+			name:     "answers every auth query",
+			username: "N/A",
+			password: "ACS::35001",
+			lines: []string{
+				">PASSWORD:Need 'Auth' username/password",
+				">STATE:1700000000,RECONNECTING,auth-failure,,,,,",
+				">PASSWORD:Need 'Auth' username/password",
+			},
+			want: answer + answer,
+		},
+		{
+			name:     "ignores other queries",
+			username: "N/A",
+			password: "ACS::35001",
+			lines: []string{
+				">PASSWORD:Need 'Private Key' password",
+				">PASSWORD:Verification Failed: 'Auth'",
+				">HOLD:Waiting for hold release:0",
+			},
+			want: "",
+		},
+		{
+			name:     "quotes credentials",
+			username: `dom\alice`,
+			password: `pa"ss\word with spaces`,
+			lines: []string{
+				">PASSWORD:Need 'Auth' username/password",
+			},
+			want: "username \"Auth\" \"dom\\\\alice\"\npassword \"Auth\" \"pa\\\"ss\\\\word with spaces\"\n",
+		},
+		{
+			name:     "passes SAML response",
+			username: "N/A",
+			password: "CRV1::instance-1/2/3::PHNhbWw%2BPC9zYW1sPg%3D%3D",
+			lines: []string{
+				">PASSWORD:Need 'Auth' username/password",
+			},
+			want: "username \"Auth\" \"N/A\"\npassword \"Auth\" \"CRV1::instance-1/2/3::PHNhbWw%2BPC9zYW1sPg%3D%3D\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := listenForManagement(t.TempDir())
+
+			if err != nil {
+				t.Fatalf("listenForManagement: %v", err)
+			}
+
+			defer m.Close()
+
+			if got := fakeOpenVPNManagement(t, m, tt.username, tt.password, tt.lines); got != tt.want {
+				t.Errorf("got answers\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeCredentialsClosedBeforeConnect(t *testing.T) {
+	m, err := listenForManagement(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("listenForManagement: %v", err)
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- m.ServeCredentials("N/A", "ACS::35001")
+	}()
+
+	m.Close()
+
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Errorf("ServeCredentials after Close: %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeCredentials didn't return after Close")
+	}
+}
+
+func TestManagementArgs(t *testing.T) {
+	m := &openVPNManagement{Socket: "/run/session/mgmt.sock"}
+	args := strings.Join(m.Args(), " ")
+
+	if !strings.Contains(args, "--management /run/session/mgmt.sock unix") {
+		t.Errorf("Args() = %q, missing the management socket", args)
+	}
+
+	for _, want := range []string{"--management-client", "--management-query-passwords", "--auth-user-pass"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Args() = %q, missing %s", args, want)
+		}
+	}
+}
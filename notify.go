@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	notificationIcon    = "network-vpn"
+	notificationTimeout = 5000
+
+	notificationsDest   = "org.freedesktop.Notifications"
+	notificationsPath   = "/org/freedesktop/Notifications"
+	notificationsMethod = "org.freedesktop.Notifications.Notify"
+)
+
+// notificationForEvent returns what to tell the user about event, or an empty summary for events
+// that don't need their attention.
+func notificationForEvent(event string, state sessionState, wasConnected bool) (summary, body string) {
+	switch event {
+	case hookAuthURLReady:
+		return "VPN login required", "Authenticate in your browser to connect " + state.Profile + "."
+	case hookConnected:
+		return "VPN connected", fmt.Sprintf("%s is up with address %s.", state.Profile, state.AssignedIP)
+	case hookDisconnected:
+		return "VPN disconnected", state.Profile + " has been disconnected."
+	case hookAuthFailed:
+		if wasConnected {
+			return "VPN reconnect failed", state.Profile + " couldn't reconnect, start it again to log in."
+		}
+
+		return "VPN authentication failed", state.Profile + " couldn't authenticate, check the logs."
+	}
+
+	return "", ""
+}
+
+// notifyArgs builds the arguments for calling org.freedesktop.Notifications.Notify on the session bus
+// with client, gdbus or busctl.
+func notifyArgs(client, summary, body string) []string {
+	timeout := strconv.Itoa(notificationTimeout)
+
+	if client == "busctl" {
+		return []string{
+			"--user", "call",
+			notificationsDest, notificationsPath, notificationsDest, "Notify",
+			"susssasa{sv}i", appName, "0", notificationIcon, summary, body, "0", "0", timeout,
+		}
+	}
+
+	return []string{
+		"call", "--session",
+		"--dest", notificationsDest,
+		"--object-path", notificationsPath,
+		"--method", notificationsMethod,
+		appName, "0", notificationIcon, summary, body, "[]", "{}", timeout,
+	}
+}
+
+// notifyCommand builds a notification call with whichever D-Bus client is installed.
+func notifyCommand(summary, body string) (command string, args []string, err error) {
+	for _, client := range []string{"gdbus", "busctl"} {
+		if commandExists(client) {
+			return client, notifyArgs(client, summary, body), nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("neither gdbus nor busctl found")
+}
+
+// sendNotification shows a desktop notification to the invoking (non-root) user.
+func sendNotification(c *config, summary, body string) {
+	command, args, err := notifyCommand(summary, body)
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Can't send desktop notifications")
+		return
+	}
+
+	cmd, err := commandAsNonRoot(c.Vpn.User, command, args...)
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed preparing desktop notification")
+		return
+	}
+
+	log.Debug().Str("summary", summary).Msg("Sending desktop notification")
+
+	// Started right away, so the notification goes out even if we exit before it finishes.
+	if err = cmd.Start(); err != nil {
+		log.Warn().Err(err).Msg("Failed sending desktop notification")
+		return
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Warn().Err(err).Msg("Failed sending desktop notification")
+		}
+	}()
+}
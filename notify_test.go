@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationArgs(t *testing.T) {
+	now := time.Now()
+	connected := sessionState{Profile: "prod", AssignedIP: "10.9.0.5", ConnectedSince: &now}
+
+	tests := []struct {
+		name         string
+		event        string
+		state        sessionState
+		wasConnected bool
+		summary      string
+		body         string
+	}{
+		{name: "auth url ready", event: hookAuthURLReady, state: sessionState{Profile: "prod"}, summary: "VPN login required", body: "Authenticate in your browser to connect prod."},
+		{name: "connected", event: hookConnected, state: connected, summary: "VPN connected", body: "prod is up with address 10.9.0.5."},
+		{name: "disconnected", event: hookDisconnected, state: connected, wasConnected: true, summary: "VPN disconnected", body: "prod has been disconnected."},
+		{name: "auth failed", event: hookAuthFailed, state: sessionState{Profile: "prod"}, summary: "VPN authentication failed", body: "prod couldn't authenticate, check the logs."},
+		{name: "reconnect failed", event: hookAuthFailed, state: connected, wasConnected: true, summary: "VPN reconnect failed", body: "prod couldn't reconnect, start it again to log in."},
+		{name: "pre-connect is silent", event: hookPreConnect, state: sessionState{Profile: "prod"}},
+		{name: "reconnecting is silent", event: hookReconnecting, state: connected, wasConnected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, body := notificationForEvent(tt.event, tt.state, tt.wasConnected)
+
+			if summary != tt.summary || body != tt.body {
+				t.Fatalf("notificationForEvent = %q, %q, want %q, %q", summary, body, tt.summary, tt.body)
+			}
+
+			if summary == "" {
+				return
+			}
+
+			wantArgs := map[string][]string{
+				"gdbus": {
+					"call", "--session",
+					"--dest", "org.freedesktop.Notifications",
+					"--object-path", "/org/freedesktop/Notifications",
+					"--method", "org.freedesktop.Notifications.Notify",
+					"aws-vpn-client", "0", "network-vpn", tt.summary, tt.body, "[]", "{}", "5000",
+				},
+				"busctl": {
+					"--user", "call",
+					"org.freedesktop.Notifications", "/org/freedesktop/Notifications", "org.freedesktop.Notifications", "Notify",
+					"susssasa{sv}i", "aws-vpn-client", "0", "network-vpn", tt.summary, tt.body, "0", "0", "5000",
+				},
+			}
+
+			for client, want := range wantArgs {
+				if got := notifyArgs(client, summary, body); !reflect.DeepEqual(got, want) {
+					t.Errorf("notifyArgs(%s) =\n%q\nwant\n%q", client, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deniedOpenVPNOptions are the options the client sets itself, overriding them breaks authentication,
+// stop/status, hooks or the up/down script.
+var deniedOpenVPNOptions = []string{
+	"config",
+	"remote",
+	"proto",
+	"auth-user-pass",
+	"script-security",
+	"up",
+	"route-up",
+	"down",
+	"writepid",
+	// Session state and hook events are read from openvpn's output, at verbosity 3 on stdout.
+	"verb",
+	"log",
+	"log-append",
+	"syslog",
+	"daemon",
+}
+
+// forcedOpenVPNArgs go after everything else so the config file can't override them either.
+var forcedOpenVPNArgs = []string{"--verb", "3"}
+
+// validateOpenVPNArgs rejects extra openvpn arguments that set options the client owns.
+func validateOpenVPNArgs(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		// --option=value is matched on the option alone.
+		option := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]
+
+		// Every management option would interfere with the credentials served over the management socket.
+		if strings.HasPrefix(option, "management") {
+			return fmt.Errorf("openvpn option '%s' is set by %s and can't be overridden", arg, appName)
+		}
+
+		for _, denied := range deniedOpenVPNOptions {
+			if option == denied {
+				return fmt.Errorf("openvpn option '%s' is set by %s and can't be overridden", arg, appName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// extraOpenVPNArgs are appended to both openvpn invocations, the profile's configured ones first so
+// arguments from the command line win.
+func extraOpenVPNArgs(p profile, cliArgs []string) (args []string, err error) {
+	args = append(append(args, p.OpenVPNArgs...), cliArgs...)
+	err = validateOpenVPNArgs(args)
+
+	return
+}
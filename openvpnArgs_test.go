@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtraOpenVPNArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile []string
+		cli     []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:    "profile before command line",
+			profile: []string{"--mssfix", "1300", "--cipher", "AES-256-GCM"},
+			cli:     []string{"--mssfix", "1200"},
+			want:    []string{"--mssfix", "1300", "--cipher", "AES-256-GCM", "--mssfix", "1200"},
+		},
+		{
+			name: "values aren't options",
+			cli:  []string{"--setenv", "up", "verb", "--pull-filter", "ignore", "route "},
+			want: []string{"--setenv", "up", "verb", "--pull-filter", "ignore", "route "},
+		},
+		{
+			name: "options that only start like denied ones",
+			cli:  []string{"--up-delay", "--remote-random", "--verb-ish"},
+			want: []string{"--up-delay", "--remote-random", "--verb-ish"},
+		},
+		{
+			name:    "denied in profile",
+			profile: []string{"--remote", "vpn.example.com", "443"},
+			wantErr: "'--remote'",
+		},
+		{
+			name:    "denied on command line",
+			profile: []string{"--mssfix", "1300"},
+			cli:     []string{"--auth-user-pass", "creds.txt"},
+			wantErr: "'--auth-user-pass'",
+		},
+		{
+			name:    "option=value",
+			cli:     []string{"--verb=5"},
+			wantErr: "'--verb=5'",
+		},
+		{
+			name:    "log file",
+			cli:     []string{"--log-append", "/tmp/openvpn.log"},
+			wantErr: "'--log-append'",
+		},
+		{
+			name:    "management prefix",
+			cli:     []string{"--management-hold"},
+			wantErr: "'--management-hold'",
+		},
+		{
+			name:    "management itself",
+			profile: []string{"--management", "127.0.0.1", "7505"},
+			wantErr: "'--management'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extraOpenVPNArgs(profile{OpenVPNArgs: tt.profile}, tt.cli)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extraOpenVPNArgs error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extraOpenVPNArgs: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extraOpenVPNArgs =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,11 +15,12 @@ type (
 		Host      string
 		Protocol  string
 		Port      int
+		AuthType  string
 		Formatted bool
 	}
 )
 
-func parseAndFormatOpenVPNConfig(inFilename, outDir string) (config *openVPNConfig, err error) {
+func parseAndFormatOpenVPNConfig(inFilename, outDir string, rules []configRule) (config *openVPNConfig, err error) {
 	fileBytes, err := os.ReadFile(inFilename)
 
 	if err != nil {
@@ -30,7 +31,7 @@ func parseAndFormatOpenVPNConfig(inFilename, outDir string) (config *openVPNConf
 
 	if outDir != "" {
 		config.Formatted = true
-		err = formatAndSaveOpenVPNConfig(fileBytes, outDir, config)
+		err = formatAndSaveOpenVPNConfig(fileBytes, outDir, config, rules)
 	} else {
 		config.Filename = inFilename
 	}
@@ -48,13 +49,9 @@ func parseOpenVPNConfig(fileBytes []byte) (config *openVPNConfig, err error) {
 	config = &openVPNConfig{}
 
 	for _, line := range sliceData {
-		tokens := strings.Split(line, " ")
+		tokens := strings.Fields(line)
 
-		if len(tokens) == 0 {
-			continue
-		}
-
-		if strings.HasPrefix("#", tokens[0]) || strings.HasPrefix(";", tokens[0]) {
+		if len(tokens) == 0 || isOpenVPNComment(tokens[0]) {
 			continue
 		}
 
@@ -81,61 +78,48 @@ func parseOpenVPNConfig(fileBytes []byte) (config *openVPNConfig, err error) {
 			}
 
 			config.Protocol = tokens[1]
+
+		case "auth-federate":
+			config.AuthType = authSAML
+
+		case "auth-user-pass":
+			if config.AuthType == "" {
+				config.AuthType = authPassword
+			}
 		}
 	}
 
+	// Without SAML or username/password the endpoint authenticates us by our certificate alone.
+	if config.AuthType == "" {
+		config.AuthType = authCertificate
+	}
+
 	return
 }
 
-func formatAndSaveOpenVPNConfig(fileBytes []byte, outDir string, config *openVPNConfig) (err error) {
-	sliceData := strings.Split(string(fileBytes), "\n")
+// formatAndSaveOpenVPNConfig writes the .ovpn file with rules applied into outDir for openvpn to use.
+func formatAndSaveOpenVPNConfig(fileBytes []byte, outDir string, config *openVPNConfig, rules []configRule) (err error) {
+	rendered, err := renderOpenVPNConfig(fileBytes, rules)
 
-	if len(sliceData) == 0 {
-		return fmt.Errorf("empty file")
+	if err != nil {
+		return
 	}
 
 	f, err := os.CreateTemp(outDir, "*.openvpn")
 
-	config.Filename = f.Name()
-
 	if err != nil {
 		return
 	}
 
 	defer f.Close()
 
-	for _, line := range sliceData {
-		line = strings.TrimSpace(line)
-
-		if strings.HasPrefix(line, "auth-user-pass") ||
-			strings.HasPrefix(line, "auth-federate") ||
-			strings.HasPrefix(line, "auth-retry interact") ||
-			strings.HasPrefix(line, "remote ") ||
-			strings.HasPrefix(line, "verb") ||
-			strings.HasPrefix(line, "remote-random-hostname") {
-			continue
-		}
-
-		_, err = f.WriteString(line + "\n")
-
-		if err != nil {
-			return
-		}
-	}
-
-	return
-}
-
-func saveOpenVPNAuthConfig(outDir, password string) (filename string, err error) {
-	authFile, err := os.CreateTemp(outDir, "*.auth.openvpn")
+	config.Filename = f.Name()
 
-	if err != nil {
+	if err = f.Chmod(0600); err != nil {
 		return
 	}
-	defer authFile.Close()
 
-	filename = authFile.Name()
-	authFile.WriteString("N/A\n" + password + "\n")
+	_, err = f.WriteString(rendered)
 
 	return
 }
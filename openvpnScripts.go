@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	scriptUp      = "up"
+	scriptRouteUp = "route-up"
+	scriptDown    = "down"
+
+	// openvpn runs scripts with a bare environment.
+	defaultScriptPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// openVPNScriptArgs makes openvpn run this binary's hook command as its up, route-up and down script,
+// with --setenv telling it where to find the session since openvpn doesn't pass on our environment.
+func openVPNScriptArgs(handle *serveHandle) []string {
+	executable, err := os.Executable()
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Can't find own executable, DNS and connection hooks are disabled")
+		return nil
+	}
+
+	invokingUser := os.Getenv("SUDO_USER")
+
+	if invokingUser == "" {
+		if u, err := user.Current(); err == nil {
+			invokingUser = u.Username
+		}
+	}
+
+	script := shellQuote(executable) + " hook "
+
+	return []string{
+		"--setenv", "AWS_VPN_PROFILE", handle.Profile,
+		"--setenv", "AWS_VPN_STATE_FILE", handle.State.filename,
+		"--setenv", "AWS_VPN_CLIENT_CONFIG", handle.ConfigFilename,
+		"--setenv", "AWS_VPN_USER", invokingUser,
+		"--up", script + scriptUp,
+		"--route-up", script + scriptRouteUp,
+		"--down", script + scriptDown,
+	}
+}
+
+// scriptRoutes turns openvpn's route_network_N/route_netmask_N variables into CIDRs.
+func scriptRoutes(getenv func(string) string) (routes []string) {
+	for i := 1; ; i++ {
+		network := getenv("route_network_" + strconv.Itoa(i))
+
+		if network == "" {
+			return
+		}
+
+		bits := 32
+
+		if mask := net.ParseIP(getenv("route_netmask_" + strconv.Itoa(i))).To4(); mask != nil {
+			bits, _ = net.IPMask(mask).Size()
+		}
+
+		routes = append(routes, network+"/"+strconv.Itoa(bits))
+	}
+}
+
+// hookAction is run by openvpn as its up, route-up and down script. It configures DNS, keeps the
+// session's state file current and announces connects and disconnects.
+func hookAction(c *cli.Context) error {
+	script := c.Args().First()
+	device := os.Getenv("dev")
+
+	if os.Getenv("PATH") == "" {
+		os.Setenv("PATH", defaultScriptPath)
+	}
+
+	awsclientConfig := &config{}
+
+	if filename := os.Getenv("AWS_VPN_CLIENT_CONFIG"); filename != "" {
+		loaded, err := loadConfig(filename)
+
+		if err != nil {
+			log.Error().Err(err).Str("config", filename).Msg("Failed loading " + appName + " config, using defaults")
+		} else {
+			awsclientConfig = loaded
+		}
+	}
+
+	// Hooks should run as whoever started the client, not as root.
+	if u := os.Getenv("AWS_VPN_USER"); u != "" {
+		awsclientConfig.Vpn.User = u
+	}
+
+	var state *sessionStateFile
+
+	if filename := os.Getenv("AWS_VPN_STATE_FILE"); filename != "" {
+		var err error
+		state, err = openSessionStateFile(filename)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed opening session state file")
+		}
+	}
+
+	update := func(fn func(*sessionState)) sessionState {
+		if state == nil {
+			s := sessionState{Profile: os.Getenv("AWS_VPN_PROFILE")}
+			fn(&s)
+			return s
+		}
+
+		state.Update(fn)
+
+		return state.Snapshot()
+	}
+
+	switch script {
+	case scriptUp:
+		update(func(s *sessionState) {
+			s.TunDevice = device
+			s.AssignedIP = os.Getenv("ifconfig_local")
+
+			// openvpn wrote its pid before running us, serve only knows the pid of sudo.
+			if pid, err := readOpenVPNPid(s); err == nil {
+				s.OpenVPNPid = pid
+			}
+		})
+
+		// A DNS failure shouldn't take the tunnel down with it, openvpn exits if this script fails.
+		if err := applyDNS(awsclientConfig, device, parseForeignOptions(os.Getenv)); err != nil {
+			log.Error().Err(err).Msg("Failed configuring DNS for the tunnel, names behind the VPN may not resolve! " + errorSuffix)
+		}
+
+	case scriptRouteUp:
+		now := time.Now()
+		snapshot := update(func(s *sessionState) {
+			s.Routes = scriptRoutes(os.Getenv)
+			s.Status = sessionStatusConnected
+			s.ConnectedSince = &now
+		})
+
+		announceEvent(awsclientConfig, hookConnected, snapshot)
+
+	case scriptDown:
+		if err := revertDNS(awsclientConfig, device); err != nil {
+			log.Warn().Err(err).Msg("Failed reverting DNS settings")
+		}
+
+		snapshot := update(func(s *sessionState) {
+			s.Status = sessionStatusDisconnected
+			s.ConnectedSince = nil
+			s.Routes = nil
+		})
+
+		announceEvent(awsclientConfig, hookDisconnected, snapshot)
+
+	default:
+		return fmt.Errorf("unknown script '%s', expected %s, %s or %s", script, scriptUp, scriptRouteUp, scriptDown)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defaultPatchName = "openvpn-v2.5.1-aws.patch"
+)
+
+//go:embed scripts/*.patch
+var embeddedPatchFiles embed.FS
+
+// listEmbeddedPatches returns the filenames of every patch compiled into the binary.
+func listEmbeddedPatches() ([]string, error) {
+	entries, err := fs.ReadDir(embeddedPatchFiles, "scripts")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func readEmbeddedPatch(name string) ([]byte, error) {
+	content, err := embeddedPatchFiles.ReadFile(path.Join("scripts", name))
+
+	if err != nil {
+		return nil, fmt.Errorf("patch '%s' is not embedded in this binary", name)
+	}
+
+	return content, nil
+}
+
+func patchListAction(c *cli.Context) error {
+	names, err := listEmbeddedPatches()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if name == defaultPatchName {
+			fmt.Println(name + " (default)")
+		} else {
+			fmt.Println(name)
+		}
+	}
+
+	return nil
+}
+
+// patchExportAction writes an embedded patch to disk so it can be inspected or applied by hand.
+func patchExportAction(c *cli.Context) error {
+	name := c.String("name")
+	outputDir := c.String("out")
+
+	content, err := readEmbeddedPatch(name)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Use 'patch list' to see the available patches.")
+		return err
+	}
+
+	filename := path.Join(outputDir, name)
+	err = os.WriteFile(filename, content, 0644)
+
+	if err != nil {
+		log.Error().Err(err).Str("filename", filename).Msg("Failed writing patch file! " + errorSuffix)
+		return err
+	}
+
+	log.Info().Msgf("Exported patch: %s", filename)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"regexp"
+)
+
+const redactedPlaceholder = "[REDACTED]"
+
+type (
+	redactionRule struct {
+		Pattern     *regexp.Regexp
+		Replacement string
+	}
+
+	// redactingWriter scrubs secrets from everything written through it before passing it on to Out.
+	// zerolog issues one Write per event, so multi-line secrets within an event are caught as well.
+	redactingWriter struct {
+		Out io.Writer
+	}
+)
+
+// Order matters, CRV1 passwords are redacted as a whole before the SID rule sees what's left of them.
+var redactionRules = []redactionRule{
+	// Inline key material from .ovpn files, e.g. <key>...</key> or <tls-crypt>...</tls-crypt>.
+	{regexp.MustCompile(`(?s)<(key|tls-auth|tls-crypt|tls-crypt-v2|secret|pkcs12)>.*?</(key|tls-auth|tls-crypt|tls-crypt-v2|secret|pkcs12)>`), "<$1>" + redactedPlaceholder + "</$1>"},
+	{regexp.MustCompile(`(?s)-----BEGIN ([A-Z0-9 ]*)PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`), redactedPlaceholder},
+
+	// Second phase auth passwords, CRV1::<sid>::<escaped SAML response>.
+	{regexp.MustCompile(`CRV1::[^\s"]+`), "CRV1::" + redactedPlaceholder},
+
+	// SAML assertions posted to our callback server.
+	{regexp.MustCompile(`(SAMLResponse"?[=:]\s*"?)[^"\s&]+`), "${1}" + redactedPlaceholder},
+
+	// Session IDs handed out by AWS in the first phase challenge.
+	{regexp.MustCompile(`instance-[^:\s"\\]+`), "instance-" + redactedPlaceholder},
+}
+
+// redact returns s with every known secret replaced by a placeholder.
+func redact(s string) string {
+	for _, rule := range redactionRules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+
+	return s
+}
+
+func (w *redactingWriter) Write(p []byte) (n int, err error) {
+	_, err = w.Out.Write([]byte(redact(string(p))))
+
+	if err != nil {
+		return
+	}
+
+	// Report the original length, callers treat short writes as errors.
+	return len(p), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// parseRouteCIDR parses a route from config, rejecting CIDRs with host bits set since openvpn won't install them.
+func parseRouteCIDR(cidr string) (*net.IPNet, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid route '%s', expected a CIDR like 10.0.0.0/16", cidr)
+	}
+
+	if !ip.Equal(network.IP) {
+		return nil, fmt.Errorf("invalid route '%s', host bits are set, did you mean %s?", cidr, network)
+	}
+
+	return network, nil
+}
+
+// pushedRoute is the text of the option a server pushes for network, which is what --pull-filter matches.
+func pushedRoute(network *net.IPNet) string {
+	if network.IP.To4() == nil {
+		return "route-ipv6 " + network.String()
+	}
+
+	return "route " + network.IP.String() + " " + net.IP(network.Mask).String()
+}
+
+// addRouteArgs routes network through the tunnel regardless of what the server pushes.
+func addRouteArgs(network *net.IPNet) []string {
+	if network.IP.To4() == nil {
+		return []string{"--route-ipv6", network.String()}
+	}
+
+	return []string{"--route", network.IP.String(), net.IP(network.Mask).String()}
+}
+
+// validateRoutes checks every CIDR in r.
+func validateRoutes(r routes) error {
+	if r.NoPull && len(r.Allow) > 0 {
+		return fmt.Errorf("routes.nopull ignores every pushed route, use routes.add to install your own or drop nopull to keep the allowed ones")
+	}
+
+	for _, list := range [][]string{r.Allow, r.Add, r.Exclude} {
+		for _, cidr := range list {
+			if _, err := parseRouteCIDR(cidr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// routeArgs translates a profile's route policy into openvpn arguments. Pushed routes are filtered with
+// --pull-filter rather than --route-nopull, which would drop the pushed DNS settings too. openvpn applies
+// the first matching filter, so excludes go first and the catch-all ignore for nopull/allow goes last.
+// Excludes and allows only match routes the server pushes exactly as written.
+func routeArgs(r routes) (args []string, err error) {
+	if err = validateRoutes(r); err != nil {
+		return
+	}
+
+	for _, cidr := range r.Exclude {
+		network, _ := parseRouteCIDR(cidr)
+		args = append(args, "--pull-filter", "ignore", pushedRoute(network))
+	}
+
+	for _, cidr := range r.Allow {
+		network, _ := parseRouteCIDR(cidr)
+		args = append(args, "--pull-filter", "accept", pushedRoute(network))
+	}
+
+	if r.NoPull || len(r.Allow) > 0 {
+		args = append(args, "--pull-filter", "ignore", "route ", "--pull-filter", "ignore", "route-ipv6 ")
+	}
+
+	for _, cidr := range r.Add {
+		network, _ := parseRouteCIDR(cidr)
+		args = append(args, addRouteArgs(network)...)
+	}
+
+	return
+}
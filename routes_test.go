@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouteArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  routes
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:   "IPv4 exclude, allow and add",
+			routes: routes{Exclude: []string{"192.168.0.0/16"}, Allow: []string{"10.1.0.0/16"}, Add: []string{"10.50.0.0/24"}},
+			want: []string{
+				"--pull-filter", "ignore", "route 192.168.0.0 255.255.0.0",
+				"--pull-filter", "accept", "route 10.1.0.0 255.255.0.0",
+				"--pull-filter", "ignore", "route ", "--pull-filter", "ignore", "route-ipv6 ",
+				"--route", "10.50.0.0", "255.255.255.0",
+			},
+		},
+		{
+			name:   "IPv6 exclude, allow and add",
+			routes: routes{Exclude: []string{"fd00:1::/64"}, Allow: []string{"fd00::/48"}, Add: []string{"fd00:50::/64"}},
+			want: []string{
+				"--pull-filter", "ignore", "route-ipv6 fd00:1::/64",
+				"--pull-filter", "accept", "route-ipv6 fd00::/48",
+				"--pull-filter", "ignore", "route ", "--pull-filter", "ignore", "route-ipv6 ",
+				"--route-ipv6", "fd00:50::/64",
+			},
+		},
+		{
+			name:   "exclude only keeps the other pushed routes",
+			routes: routes{Exclude: []string{"10.2.0.0/16"}},
+			want:   []string{"--pull-filter", "ignore", "route 10.2.0.0 255.255.0.0"},
+		},
+		{
+			name:   "nopull with own routes",
+			routes: routes{NoPull: true, Add: []string{"10.50.0.0/16", "fd00::/64"}},
+			want: []string{
+				"--pull-filter", "ignore", "route ", "--pull-filter", "ignore", "route-ipv6 ",
+				"--route", "10.50.0.0", "255.255.0.0",
+				"--route-ipv6", "fd00::/64",
+			},
+		},
+		{
+			name:    "nopull with allow",
+			routes:  routes{NoPull: true, Allow: []string{"10.1.0.0/16"}},
+			wantErr: "routes.nopull ignores every pushed route",
+		},
+		{
+			name:    "IPv4 host bits set",
+			routes:  routes{Add: []string{"10.1.2.3/16"}},
+			wantErr: "host bits are set, did you mean 10.1.0.0/16?",
+		},
+		{
+			name:    "IPv6 host bits set",
+			routes:  routes{Exclude: []string{"fd00::1/64"}},
+			wantErr: "host bits are set, did you mean fd00::/64?",
+		},
+		{
+			name:    "not a CIDR",
+			routes:  routes{Allow: []string{"10.1.0.0"}},
+			wantErr: "invalid route '10.1.0.0', expected a CIDR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routeArgs(tt.routes)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("routeArgs error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("routeArgs: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routeArgs =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// samlReuseMargin keeps us from reusing a SAML response that expires while we connect with it.
+const samlReuseMargin = 30 * time.Second
+
+type (
+	cachedSAML struct {
+		Response string
+		Expiry   time.Time
+	}
+)
+
+func (s cachedSAML) Valid() bool {
+	return s.Response != "" && time.Now().Add(samlReuseMargin).Before(s.Expiry)
+}
+
+// samlSecretName is where a profile's SAML response is kept when secrets.remembersaml is set.
+func samlSecretName(profile string) string {
+	return profile + "/saml"
+}
+
+// parseSAMLExpiry returns when the assertion inside a base64 encoded SAMLResponse stops being valid,
+// taken from its Conditions NotOnOrAfter, or the SubjectConfirmationData one when there are no conditions.
+func parseSAMLExpiry(SAMLResponse string) (expiry time.Time, err error) {
+	raw, err := base64.StdEncoding.DecodeString(SAMLResponse)
+
+	if err != nil {
+		return
+	}
+
+	var confirmationExpiry string
+
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+
+	for {
+		token, tokenErr := decoder.Token()
+
+		if tokenErr == io.EOF {
+			break
+		}
+
+		if tokenErr != nil {
+			return expiry, tokenErr
+		}
+
+		element, ok := token.(xml.StartElement)
+
+		if !ok {
+			continue
+		}
+
+		for _, attr := range element.Attr {
+			if attr.Name.Local != "NotOnOrAfter" {
+				continue
+			}
+
+			switch element.Name.Local {
+			case "Conditions":
+				return time.Parse(time.RFC3339, attr.Value)
+			case "SubjectConfirmationData":
+				confirmationExpiry = attr.Value
+			}
+		}
+	}
+
+	if confirmationExpiry == "" {
+		return expiry, fmt.Errorf("no NotOnOrAfter found in SAML response")
+	}
+
+	return time.Parse(time.RFC3339, confirmationExpiry)
+}
+
+// parseSAMLSubject returns who logged in, the NameID of the assertion inside a base64 encoded SAMLResponse.
+func parseSAMLSubject(SAMLResponse string) (subject string, err error) {
+	raw, err := base64.StdEncoding.DecodeString(SAMLResponse)
+
+	if err != nil {
+		return
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+
+	for {
+		token, tokenErr := decoder.Token()
+
+		if tokenErr == io.EOF {
+			break
+		}
+
+		if tokenErr != nil {
+			return "", tokenErr
+		}
+
+		if element, ok := token.(xml.StartElement); ok && element.Name.Local == "NameID" {
+			err = decoder.DecodeElement(&subject, &element)
+
+			return strings.TrimSpace(subject), err
+		}
+	}
+
+	return "", fmt.Errorf("no NameID found in SAML response")
+}
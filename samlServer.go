@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const samlStatusPath = "/status"
+
+type (
+	// samlPageData is what the callback pages are rendered with, embedded or from server.templates.
+	samlPageData struct {
+		Profile  string
+		Endpoint string
+		// User is the NameID the identity provider logged in, empty if the response didn't have one.
+		User   string
+		Status string
+		Error  string
+	}
+
+	// samlStatus is served on samlStatusPath, the success page polls it until the tunnel is up.
+	samlStatus struct {
+		Profile        string     `json:"profile"`
+		Endpoint       string     `json:"endpoint"`
+		Status         string     `json:"status"`
+		AssignedIP     string     `json:"assignedIp,omitempty"`
+		ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	}
+)
+
+//go:embed html/index.html
+var welcomeHtmlFile embed.FS
+
+//go:embed html/error.html
+var errorHtmlFile embed.FS
+
+func startSAMLServer(handle *serveHandle) {
+	if dir := handle.Config.Server.Templates; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			log.Warn().Str("templates", dir).Msg("server.templates is not a directory, using the embedded pages")
+		}
+	}
+
+	http.HandleFunc("/", SAMLServer(handle))
+	http.HandleFunc(samlStatusPath, SAMLStatusServer(handle))
+
+	var err error
+
+	if handle.Config.Server.TLS {
+		certFile, keyFile, tlsErr := samlServerTLSFiles(handle.Config.Server)
+
+		if tlsErr != nil {
+			log.Fatal().Err(tlsErr).Msg("Failed loading certificate for the SAML server! " + errorSuffix)
+		}
+
+		err = http.ListenAndServeTLS(handle.Config.Server.Addr, certFile, keyFile, nil)
+	} else {
+		err = http.ListenAndServe(handle.Config.Server.Addr, nil)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal().Err(err).Str("addr", handle.Config.Server.Addr).Msg("Failed starting SAML server! Is another session using server.addr? " + errorSuffix)
+	}
+}
+
+// renderPageTemplate executes the template in filename, or in filePath of file when filename is empty.
+func renderPageTemplate(file embed.FS, filePath, filename string, data samlPageData) ([]byte, error) {
+	var page bytes.Buffer
+	var tmpl *template.Template
+	var err error
+
+	if filename != "" {
+		tmpl, err = template.ParseFiles(filename)
+	} else {
+		tmpl, err = template.ParseFS(file, filePath)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmpl.Execute(&page, data)
+
+	return page.Bytes(), err
+}
+
+// renderSAMLPage renders a callback page, preferring a file of the same name in server.templates over
+// the embedded one. Templates are read on every request so custom pages can be worked on without restarting.
+// Pages are rendered before anything is written so a broken template still ends up as a proper response.
+func (handle *serveHandle) renderSAMLPage(file embed.FS, filePath string, w http.ResponseWriter, status int, data samlPageData) {
+	var page []byte
+	var err error
+
+	if dir := handle.Config.Server.Templates; dir != "" {
+		if filename := path.Join(dir, path.Base(filePath)); fileExists(filename) {
+			if page, err = renderPageTemplate(file, filePath, filename, data); err != nil {
+				log.Error().Err(err).Str("template", filename).Msg("Failed rendering custom page, using the embedded one")
+				page = nil
+			}
+		}
+	}
+
+	if page == nil {
+		if page, err = renderPageTemplate(file, filePath, "", data); err != nil {
+			log.Error().Err(err).Msgf("failed rendering HTML file: %s", filePath)
+			http.Error(w, "Could not load HTML file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page)
+}
+
+func (handle *serveHandle) samlStatus() samlStatus {
+	status := samlStatus{
+		Profile:  handle.Profile,
+		Endpoint: handle.OpenVPNConnectionConfig.Host,
+		Status:   sessionStatusConnecting,
+	}
+
+	if handle.State != nil {
+		state := handle.State.Snapshot()
+		status.Status = state.Status
+		status.AssignedIP = state.AssignedIP
+		status.ConnectedSince = state.ConnectedSince
+	}
+
+	return status
+}
+
+func (handle *serveHandle) samlPageData(SAMLResponse, errorReason string) samlPageData {
+	status := handle.samlStatus()
+	user, _ := parseSAMLSubject(SAMLResponse)
+
+	return samlPageData{
+		Profile:  status.Profile,
+		Endpoint: status.Endpoint,
+		User:     user,
+		Status:   status.Status,
+		Error:    errorReason,
+	}
+}
+
+// expectSAMLResponse makes acceptSAMLResponse take the next response. Logins call it before handing out
+// the auth URL, the response is then buffered in handle.SAMLResponse until they receive it.
+func (handle *serveHandle) expectSAMLResponse() {
+	handle.samlMu.Lock()
+	defer handle.samlMu.Unlock()
+
+	handle.samlWaiting = true
+}
+
+// acceptSAMLResponse hands a posted SAML response to the waiting login. It fails for responses that were
+// already used, e.g. by reloading the page, and when no login is waiting for one.
+func (handle *serveHandle) acceptSAMLResponse(SAMLResponse string) (errorReason string) {
+	handle.samlMu.Lock()
+	defer handle.samlMu.Unlock()
+
+	if SAMLResponse == handle.lastSAMLResponse {
+		return "This SAML response was already used. Log in again from the link in the terminal if the tunnel isn't up."
+	}
+
+	if !handle.samlWaiting {
+		return "No login is waiting for a SAML response right now. Use the latest link from the terminal."
+	}
+
+	// Only one response is taken per login, so the buffer is always free here.
+	handle.samlWaiting = false
+	handle.lastSAMLResponse = SAMLResponse
+	handle.SAMLResponse <- SAMLResponse
+
+	return ""
+}
+
+func SAMLServer(handle *serveHandle) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			if err := r.ParseForm(); err != nil {
+				handle.renderSAMLPage(errorHtmlFile, "html/error.html", w, http.StatusBadRequest, handle.samlPageData("", "The identity provider sent a form that couldn't be read."))
+				log.Error().Err(err).Msg("ParseForm() returned unexpected error")
+				return
+			}
+
+			SAMLResponse := r.FormValue("SAMLResponse")
+			if len(SAMLResponse) == 0 {
+				handle.renderSAMLPage(errorHtmlFile, "html/error.html", w, http.StatusBadRequest, handle.samlPageData("", "The identity provider didn't send a SAMLResponse."))
+				log.Error().Msg("SAMLResponse field empty")
+				return
+			}
+
+			if reason := handle.acceptSAMLResponse(SAMLResponse); reason != "" {
+				handle.renderSAMLPage(errorHtmlFile, "html/error.html", w, http.StatusConflict, handle.samlPageData(SAMLResponse, reason))
+				log.Error().Msg("Rejected SAML response: " + reason)
+				return
+			}
+
+			handle.renderSAMLPage(welcomeHtmlFile, "html/index.html", w, http.StatusOK, handle.samlPageData(SAMLResponse, ""))
+		default:
+			handle.renderSAMLPage(errorHtmlFile, "html/error.html", w, http.StatusMethodNotAllowed, handle.samlPageData("", "Expected the identity provider to POST its SAML response, got "+r.Method+"."))
+			log.Error().Msgf("Error: POST method expected, %s received", r.Method)
+		}
+	}
+}
+
+// SAMLStatusServer answers the success page's polling with the tunnel's status.
+func SAMLStatusServer(handle *serveHandle) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "GET method expected", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(handle.samlStatus())
+	}
+}
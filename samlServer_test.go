@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSAMLHandle() *serveHandle {
+	return &serveHandle{
+		Config:                  &config{},
+		OpenVPNConnectionConfig: &openVPNConfig{Host: "cvpn-endpoint.example.com"},
+		Profile:                 "prod",
+		SAMLResponse:            make(chan string, 1),
+	}
+}
+
+func postSAMLResponse(handle *serveHandle, SAMLResponse string) int {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{"SAMLResponse": {SAMLResponse}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	SAMLServer(handle)(w, r)
+
+	return w.Code
+}
+
+func TestSAMLServerAcceptsResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect bool
+		posts  []string
+		codes  []int
+		// received is what the login gets from handle.SAMLResponse, empty if nothing was handed over.
+		received string
+	}{
+		{
+			name:  "no login waiting",
+			posts: []string{"response-1"},
+			codes: []int{http.StatusConflict},
+		},
+		{
+			name:     "posted before the login receives",
+			expect:   true,
+			posts:    []string{"response-1"},
+			codes:    []int{http.StatusOK},
+			received: "response-1",
+		},
+		{
+			name:     "reloaded page",
+			expect:   true,
+			posts:    []string{"response-1", "response-1"},
+			codes:    []int{http.StatusOK, http.StatusConflict},
+			received: "response-1",
+		},
+		{
+			name:     "second login in another tab",
+			expect:   true,
+			posts:    []string{"response-1", "response-2"},
+			codes:    []int{http.StatusOK, http.StatusConflict},
+			received: "response-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handle := newTestSAMLHandle()
+
+			if tt.expect {
+				handle.expectSAMLResponse()
+			}
+
+			// Nothing receives yet, like a login still running the auth-url-ready hook or opening the browser.
+			for i, post := range tt.posts {
+				if code := postSAMLResponse(handle, post); code != tt.codes[i] {
+					t.Errorf("POST %d got status %d, want %d", i+1, code, tt.codes[i])
+				}
+			}
+
+			select {
+			case got := <-handle.SAMLResponse:
+				if got != tt.received {
+					t.Errorf("login received %q, want %q", got, tt.received)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.received != "" {
+					t.Errorf("login received nothing, want %q", tt.received)
+				}
+			}
+		})
+	}
+}
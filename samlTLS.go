@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	samlCertFilename = "saml-server.crt"
+	samlKeyFilename  = "saml-server.key"
+
+	samlCertValidity = 365 * 24 * time.Hour
+	// samlCertRenewBefore replaces a generated certificate this long before it expires.
+	samlCertRenewBefore = 30 * 24 * time.Hour
+)
+
+// samlServerPort is the port the SAML server listens on, which AWS gets in the first phase password
+// so the IdP's response can find its way back to us.
+func samlServerPort(addr string) (string, error) {
+	_, port, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid server.addr '%s': %w", addr, err)
+	}
+
+	if port == "" {
+		return "", fmt.Errorf("invalid server.addr '%s': missing port", addr)
+	}
+
+	return port, nil
+}
+
+// samlServerURL is where the SAML server can be reached, for logs and docs.
+func samlServerURL(s server) string {
+	scheme := "http"
+
+	if s.TLS {
+		scheme = "https"
+	}
+
+	host, port, err := net.SplitHostPort(s.Addr)
+
+	if err != nil {
+		return scheme + "://" + s.Addr
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// samlCertHosts are the names the generated certificate is valid for, localhost and the listen address.
+func samlCertHosts(addr string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		for _, h := range hosts {
+			if h == host {
+				return hosts
+			}
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
+
+// samlServerTLSFiles returns the certificate and key the SAML server serves TLS with: server.cert and
+// server.key when configured, otherwise a self-signed certificate kept in the config dir, generated when
+// it's missing, about to expire or doesn't cover server.addr.
+func samlServerTLSFiles(s server) (certFile, keyFile string, err error) {
+	if s.Cert != "" || s.Key != "" {
+		if s.Cert == "" || s.Key == "" {
+			return "", "", fmt.Errorf("server.cert and server.key have to be set together")
+		}
+
+		_, err = tls.LoadX509KeyPair(s.Cert, s.Key)
+
+		return s.Cert, s.Key, err
+	}
+
+	dir, err := getHomeDirConfigPath()
+
+	if err != nil {
+		return
+	}
+
+	certFile, keyFile = path.Join(dir, samlCertFilename), path.Join(dir, samlKeyFilename)
+	hosts := samlCertHosts(s.Addr)
+
+	if usableSelfSignedCert(certFile, keyFile, hosts) {
+		return
+	}
+
+	log.Info().Str("cert", certFile).Strs("hosts", hosts).Msg("Generating self-signed certificate for the SAML server")
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	err = generateSelfSignedCert(certFile, keyFile, hosts)
+
+	return
+}
+
+func usableSelfSignedCert(certFile, keyFile string, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+	if err != nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+
+	if err != nil || time.Now().Add(samlCertRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateSelfSignedCert(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: appName + " SAML server"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(samlCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	secretsBackendSecretService = "secretservice"
+	secretsBackendPass          = "pass"
+	secretsBackendFile          = "file"
+
+	defaultSecretsFilename = "secrets.enc"
+)
+
+var errSecretNotFound = errors.New("secret not found")
+
+type (
+	// secretStore keeps credentials off disk in plaintext. Names look like "<profile>/password".
+	secretStore interface {
+		Get(name string) (string, error)
+		Set(name, value string) error
+		Delete(name string) error
+	}
+
+	// secretServiceStore keeps secrets in the freedesktop Secret Service (gnome-keyring, KWallet) through
+	// libsecret's secret-tool, which talks to it over D-Bus.
+	secretServiceStore struct {
+		config *config
+	}
+
+	// passStore keeps secrets in the pass password manager under aws-vpn-client/.
+	passStore struct {
+		config *config
+	}
+)
+
+// openSecretStore returns the configured secret backend, nil if none is configured.
+func openSecretStore(c *config) (secretStore, error) {
+	switch c.Secrets.Backend {
+	case "":
+		return nil, nil
+	case secretsBackendSecretService:
+		return &secretServiceStore{config: c}, nil
+	case secretsBackendPass:
+		return &passStore{config: c}, nil
+	case secretsBackendFile:
+		filename := c.Secrets.File
+
+		if filename == "" {
+			dir, err := getHomeDirConfigPath()
+
+			if err != nil {
+				return nil, err
+			}
+
+			filename = path.Join(dir, defaultSecretsFilename)
+		}
+
+		return &fileStore{Filename: filename}, nil
+	}
+
+	return nil, fmt.Errorf("unknown secrets backend '%s', expected %s, %s or %s", c.Secrets.Backend, secretsBackendSecretService, secretsBackendPass, secretsBackendFile)
+}
+
+// runSecretCommand runs a secret backend's command as the invoking user, whose keyring or password store it is.
+func runSecretCommand(c *config, stdin string, command string, args ...string) (string, error) {
+	cmd, err := commandAsNonRoot(c.Vpn.User, command, args...)
+
+	if err != nil {
+		return "", err
+	}
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+func (s *secretServiceStore) attributes(name string) []string {
+	return []string{"service", appName, "name", name}
+}
+
+func (s *secretServiceStore) Get(name string) (string, error) {
+	out, err := runSecretCommand(s.config, "", "secret-tool", append([]string{"lookup"}, s.attributes(name)...)...)
+
+	// secret-tool exits non-zero without output for unknown secrets.
+	if err != nil || out == "" {
+		if err != nil {
+			log.Debug().Err(err).Str("secret", name).Msg("Secret Service lookup failed")
+		}
+
+		return "", errSecretNotFound
+	}
+
+	return out, nil
+}
+
+func (s *secretServiceStore) Set(name, value string) error {
+	_, err := runSecretCommand(s.config, value, "secret-tool", append([]string{"store", "--label", appName + " " + name}, s.attributes(name)...)...)
+
+	return err
+}
+
+func (s *secretServiceStore) Delete(name string) error {
+	_, err := runSecretCommand(s.config, "", "secret-tool", append([]string{"clear"}, s.attributes(name)...)...)
+
+	return err
+}
+
+func (s *passStore) entry(name string) string {
+	return appName + "/" + name
+}
+
+func (s *passStore) Get(name string) (string, error) {
+	out, err := runSecretCommand(s.config, "", "pass", "show", s.entry(name))
+
+	if err != nil {
+		if strings.Contains(err.Error(), "is not in the password store") {
+			return "", errSecretNotFound
+		}
+
+		return "", err
+	}
+
+	// pass adds a newline to single line secrets.
+	if strings.Count(out, "\n") == 1 {
+		out = strings.TrimSuffix(out, "\n")
+	}
+
+	return out, nil
+}
+
+func (s *passStore) Set(name, value string) error {
+	_, err := runSecretCommand(s.config, value, "pass", "insert", "--multiline", "--force", s.entry(name))
+
+	return err
+}
+
+func (s *passStore) Delete(name string) error {
+	_, err := runSecretCommand(s.config, "", "pass", "rm", "--force", s.entry(name))
+
+	return err
+}
+
+// passwordSecretName is where the password of a password auth profile is looked up.
+func passwordSecretName(profile string) string {
+	return profile + "/password"
+}
+
+func secretSetAction(c *cli.Context) error {
+	name := c.Args().First()
+
+	if name == "" {
+		return fmt.Errorf("missing secret name, e.g. prod/password")
+	}
+
+	awsclientConfig, store, err := loadSecretStore()
+
+	if err != nil {
+		return err
+	}
+
+	var value string
+
+	if filename := c.String("from-file"); filename != "" {
+		content, err := os.ReadFile(filename)
+
+		if err != nil {
+			return err
+		}
+
+		value = string(content)
+	} else if value, err = readLine("Value for "+name+": ", true); err != nil {
+		return err
+	}
+
+	if err = store.Set(name, value); err != nil {
+		return err
+	}
+
+	log.Info().Str("secret", name).Str("backend", awsclientConfig.Secrets.Backend).Msg("Stored secret.")
+
+	return nil
+}
+
+func secretDeleteAction(c *cli.Context) error {
+	name := c.Args().First()
+
+	if name == "" {
+		return fmt.Errorf("missing secret name, e.g. prod/password")
+	}
+
+	awsclientConfig, store, err := loadSecretStore()
+
+	if err != nil {
+		return err
+	}
+
+	if err = store.Delete(name); err != nil {
+		return err
+	}
+
+	log.Info().Str("secret", name).Str("backend", awsclientConfig.Secrets.Backend).Msg("Deleted secret.")
+
+	return nil
+}
+
+func loadSecretStore() (*config, secretStore, error) {
+	configFilename, err := searchConfigFilename()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s not found in working directory or user config folder", defaultConfigFilename)
+	}
+
+	awsclientConfig, err := loadConfig(configFilename)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := openSecretStore(awsclientConfig)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if store == nil {
+		return nil, nil, fmt.Errorf("no secrets backend configured, set secrets.backend to %s, %s or %s", secretsBackendSecretService, secretsBackendPass, secretsBackendFile)
+	}
+
+	return awsclientConfig, store, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	secretsFileVersion = 1
+
+	// Scrypt's recommended parameters for interactive logins, about 100ms and 32 MiB per derivation.
+	secretsFileScryptN   = 1 << 15
+	secretsFileScryptR   = 8
+	secretsFileScryptP   = 1
+	secretsFileKeyLength = 32
+
+	// Limits on the parameters read from a file, so an edited or corrupt one can't make scrypt allocate
+	// or compute without bound. Scrypt needs 128*N*r bytes.
+	secretsFileMaxScryptN      = 1 << 20
+	secretsFileMaxScryptR      = 32
+	secretsFileMaxScryptP      = 16
+	secretsFileMaxScryptMemory = 1 << 30
+
+	secretsPassphraseEnv = "AWS_VPN_SECRETS_PASSPHRASE"
+)
+
+type (
+	// fileStore keeps secrets in a file encrypted with AES-256-GCM, keyed by a passphrase from
+	// $AWS_VPN_SECRETS_PASSPHRASE or the terminal.
+	fileStore struct {
+		Filename string
+
+		passphrase string
+	}
+
+	secretsFile struct {
+		Version int    `json:"version"`
+		N       int    `json:"n"`
+		R       int    `json:"r"`
+		P       int    `json:"p"`
+		Salt    []byte `json:"salt"`
+		Nonce   []byte `json:"nonce"`
+		Data    []byte `json:"data"`
+	}
+)
+
+func (s *fileStore) getPassphrase() (string, error) {
+	if s.passphrase != "" {
+		return s.passphrase, nil
+	}
+
+	if s.passphrase = os.Getenv(secretsPassphraseEnv); s.passphrase != "" {
+		return s.passphrase, nil
+	}
+
+	passphrase, err := readLine("Passphrase for "+s.Filename+": ", true)
+
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" {
+		return "", fmt.Errorf("empty passphrase")
+	}
+
+	s.passphrase = passphrase
+
+	return passphrase, nil
+}
+
+// validate checks what load reads from the file before it's used for decryption.
+func (f *secretsFile) validate() error {
+	if f.Version != secretsFileVersion {
+		return fmt.Errorf("unsupported secrets file version %d", f.Version)
+	}
+
+	if f.N < 2 || f.N > secretsFileMaxScryptN || f.N&(f.N-1) != 0 {
+		return fmt.Errorf("invalid scrypt N %d, expected a power of two up to %d", f.N, secretsFileMaxScryptN)
+	}
+
+	if f.R < 1 || f.R > secretsFileMaxScryptR || f.P < 1 || f.P > secretsFileMaxScryptP {
+		return fmt.Errorf("invalid scrypt r %d and p %d, expected 1-%d and 1-%d", f.R, f.P, secretsFileMaxScryptR, secretsFileMaxScryptP)
+	}
+
+	if 128*f.N*f.R > secretsFileMaxScryptMemory {
+		return fmt.Errorf("scrypt N %d and r %d need more than %d MiB", f.N, f.R, secretsFileMaxScryptMemory>>20)
+	}
+
+	if len(f.Salt) == 0 {
+		return fmt.Errorf("missing salt")
+	}
+
+	return nil
+}
+
+func (f *secretsFile) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, secretsFileKeyLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// load decrypts all secrets, an empty set if the file doesn't exist yet.
+func (s *fileStore) load() (secrets map[string]string, err error) {
+	content, err := os.ReadFile(s.Filename)
+
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return
+	}
+
+	var f secretsFile
+
+	if err = json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("corrupt secrets file %s: %w", s.Filename, err)
+	}
+
+	if err = f.validate(); err != nil {
+		return nil, fmt.Errorf("corrupt secrets file %s: %w", s.Filename, err)
+	}
+
+	passphrase, err := s.getPassphrase()
+
+	if err != nil {
+		return
+	}
+
+	aead, err := f.aead(passphrase)
+
+	if err != nil {
+		return
+	}
+
+	// Open panics on a nonce of the wrong size.
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("corrupt secrets file %s: nonce is %d bytes, expected %d", s.Filename, len(f.Nonce), aead.NonceSize())
+	}
+
+	plaintext, err := aead.Open(nil, f.Nonce, f.Data, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt %s, wrong passphrase?", s.Filename)
+	}
+
+	err = json.Unmarshal(plaintext, &secrets)
+
+	return
+}
+
+func (s *fileStore) save(secrets map[string]string) error {
+	passphrase, err := s.getPassphrase()
+
+	if err != nil {
+		return err
+	}
+
+	f := secretsFile{
+		Version: secretsFileVersion,
+		N:       secretsFileScryptN,
+		R:       secretsFileScryptR,
+		P:       secretsFileScryptP,
+		Salt:    make([]byte, 16),
+	}
+
+	if _, err = rand.Read(f.Salt); err != nil {
+		return err
+	}
+
+	aead, err := f.aead(passphrase)
+
+	if err != nil {
+		return err
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+
+	if _, err = rand.Read(f.Nonce); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+
+	if err != nil {
+		return err
+	}
+
+	f.Data = aead.Seal(nil, f.Nonce, plaintext, nil)
+
+	content, err := json.Marshal(f)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Filename, content, 0600)
+}
+
+func (s *fileStore) Get(name string) (string, error) {
+	secrets, err := s.load()
+
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secrets[name]
+
+	if !ok {
+		return "", errSecretNotFound
+	}
+
+	return value, nil
+}
+
+func (s *fileStore) Set(name, value string) error {
+	secrets, err := s.load()
+
+	if err != nil {
+		return err
+	}
+
+	secrets[name] = value
+
+	return s.save(secrets)
+}
+
+func (s *fileStore) Delete(name string) error {
+	secrets, err := s.load()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := secrets[name]; !ok {
+		return errSecretNotFound
+	}
+
+	delete(secrets, name)
+
+	return s.save(secrets)
+}
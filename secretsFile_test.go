@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreEncrypts(t *testing.T) {
+	filename := path.Join(t.TempDir(), defaultSecretsFilename)
+	store := &fileStore{Filename: filename, passphrase: "correct horse"}
+
+	if err := store.Set("prod/password", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	info, err := os.Stat(filename)
+
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file mode %o, want 600", info.Mode().Perm())
+	}
+
+	content, err := os.ReadFile(filename)
+
+	if err != nil {
+		t.Fatalf("reading secrets file: %v", err)
+	}
+
+	if strings.Contains(string(content), "hunter2") || strings.Contains(string(content), "prod/password") {
+		t.Errorf("secrets file has plaintext: %s", content)
+	}
+
+	var f secretsFile
+
+	if err = json.Unmarshal(content, &f); err != nil {
+		t.Fatalf("parsing secrets file: %v", err)
+	}
+
+	if f.Version != secretsFileVersion || f.N != secretsFileScryptN || f.R != secretsFileScryptR || f.P != secretsFileScryptP {
+		t.Errorf("got version %d with scrypt N=%d r=%d p=%d", f.Version, f.N, f.R, f.P)
+	}
+
+	// A fresh store has to derive the key from the file again.
+	if got, err := (&fileStore{Filename: filename, passphrase: "correct horse"}).Get("prod/password"); err != nil || got != "hunter2" {
+		t.Errorf("Get from a new store = %q, %v, want hunter2", got, err)
+	}
+}
+
+func TestFileStoreWrongPassphrase(t *testing.T) {
+	filename := path.Join(t.TempDir(), defaultSecretsFilename)
+
+	if err := (&fileStore{Filename: filename, passphrase: "correct horse"}).Set("prod/password", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	before, _ := os.ReadFile(filename)
+	store := &fileStore{Filename: filename, passphrase: "battery staple"}
+
+	if _, err := store.Get("prod/password"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Get with the wrong passphrase: %v, want a wrong passphrase error", err)
+	}
+
+	if err := store.Set("prod/other", "value"); err == nil {
+		t.Error("Set with the wrong passphrase succeeded")
+	}
+
+	if after, _ := os.ReadFile(filename); string(after) != string(before) {
+		t.Error("secrets file changed after a wrong passphrase")
+	}
+}
+
+func TestFileStorePassphraseFromEnv(t *testing.T) {
+	t.Setenv(secretsPassphraseEnv, "correct horse")
+	filename := path.Join(t.TempDir(), defaultSecretsFilename)
+
+	if err := (&fileStore{Filename: filename}).Set("prod/password", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if got, err := (&fileStore{Filename: filename, passphrase: "correct horse"}).Get("prod/password"); err != nil || got != "hunter2" {
+		t.Errorf("Get = %q, %v, want hunter2", got, err)
+	}
+}
+
+func TestFileStoreRejectsCorruptFiles(t *testing.T) {
+	valid := secretsFile{
+		Version: secretsFileVersion,
+		N:       secretsFileScryptN,
+		R:       secretsFileScryptR,
+		P:       secretsFileScryptP,
+		Salt:    []byte("0123456789abcdef"),
+		Nonce:   []byte("0123456789ab"),
+		Data:    []byte("ciphertext"),
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(f *secretsFile)
+		wantErr string
+	}{
+		{name: "unknown version", edit: func(f *secretsFile) { f.Version = 2 }, wantErr: "unsupported secrets file version 2"},
+		{name: "huge N", edit: func(f *secretsFile) { f.N = 1 << 40 }, wantErr: "invalid scrypt N"},
+		{name: "N not a power of two", edit: func(f *secretsFile) { f.N = 30000 }, wantErr: "invalid scrypt N"},
+		{name: "missing N", edit: func(f *secretsFile) { f.N = 0 }, wantErr: "invalid scrypt N"},
+		{name: "r out of range", edit: func(f *secretsFile) { f.R = 1 << 20 }, wantErr: "invalid scrypt r"},
+		{name: "p out of range", edit: func(f *secretsFile) { f.P = 0 }, wantErr: "invalid scrypt r"},
+		{name: "too much memory", edit: func(f *secretsFile) { f.N, f.R = 1<<20, 32 }, wantErr: "need more than 1024 MiB"},
+		{name: "missing salt", edit: func(f *secretsFile) { f.Salt = nil }, wantErr: "missing salt"},
+		{name: "short nonce", edit: func(f *secretsFile) { f.Nonce = []byte("short") }, wantErr: "nonce is 5 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.edit(&f)
+			content, _ := json.Marshal(f)
+			filename := path.Join(t.TempDir(), defaultSecretsFilename)
+
+			if err := os.WriteFile(filename, content, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := (&fileStore{Filename: filename, passphrase: "correct horse"}).Get("prod/password")
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Get: %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
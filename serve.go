@@ -2,13 +2,16 @@ package main
 
 import (
 	"errors"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"strconv"
-
-	"embed"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -19,24 +22,50 @@ import (
 type (
 	serveHandle struct {
 		Config                  *config
+		ConfigFilename          string
 		OpenVPNConnectionConfig *openVPNConfig
 		TempDir                 string
+		Profile                 string
+		State                   *sessionStateFile
+		OpenVPNArgs             []string
+		AuthType                string
+		Secrets                 secretStore
 
+		// SAMLResponse is buffered so the IdP can post back before samlCredentials gets to receiving.
 		SAMLResponse chan string
 		ServiceIPv4  string
 		ServiceHost  string
-	}
-)
 
-//go:embed html/index.html
-var welcomeHtmlFile embed.FS
+		// The most recent SAML response, reused on reconnect while it's valid.
+		cachedSAML cachedSAML
 
-//go:embed html/error.html
-var errorHtmlFile embed.FS
+		tunnelMu         sync.Mutex
+		tunnel           *os.Process
+		tunnelConnected  bool
+		tunnelAuthFailed bool
+
+		// Guards lastSAMLResponse, the last response posted to the SAML server, and samlWaiting, set while
+		// a login is waiting for one.
+		samlMu           sync.Mutex
+		lastSAMLResponse string
+		samlWaiting      bool
+	}
+)
 
 func serveAction(c *cli.Context) error {
 	openVPNConfig := c.String("config")
 	tmpOpenVPNConfigDir := c.String("configTmpDir")
+	profile := c.String("profile")
+
+	if openVPNConfig == "" && profile == "" {
+		log.Fatal().Msg("Either --config or the --profile of an imported config is required!")
+	}
+
+	if profile == "" {
+		profile = profileNameFromConfig(openVPNConfig)
+	}
+
+	profile = sanitizeProfileName(profile)
 	awsClientConfigFilename, err := searchConfigFilename()
 
 	if errors.Is(os.ErrNotExist, err) {
@@ -51,21 +80,110 @@ func serveAction(c *cli.Context) error {
 		log.Fatal().Str("config", awsClientConfigFilename).Err(err).Msg("unexpected error loading " + appName + " config! " + errorSuffix)
 	}
 
-	if !awsclientConfig.Debug {
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if awsclientConfig.Debug && !c.IsSet("log-level") {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	validateHooks(awsclientConfig.Hooks)
+
+	if openVPNConfig == "" {
+		if openVPNConfig = awsclientConfig.profile(profile).Config; openVPNConfig == "" {
+			log.Fatal().Str("profile", profile).Msg("Profile has no config, import an .ovpn file for it or pass --config")
+		}
+	}
+
+	if err = validateRoutes(awsclientConfig.profile(profile).Routes); err != nil {
+		log.Fatal().Err(err).Str("profile", profile).Msg("Invalid routes in " + appName + " config!")
+	}
+
+	rules, err := configRules(awsclientConfig, profile)
+
+	if err != nil {
+		log.Fatal().Err(err).Str("profile", profile).Msg("Invalid openvpn config rules in " + appName + " config!")
 	}
 
+	secrets, err := openSecretStore(awsclientConfig)
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid secrets in " + appName + " config!")
+	}
+
+	if keySecret := awsclientConfig.profile(profile).KeySecret; keySecret != "" {
+		if secrets == nil {
+			log.Fatal().Str("profile", profile).Msg("Profile has a keysecret but no secrets backend is configured!")
+		}
+
+		key, err := secrets.Get(keySecret)
+
+		if err != nil {
+			log.Fatal().Err(err).Str("secret", keySecret).Msg("Failed reading private key from secret store!")
+		}
+
+		// The key only ever lands in the private session directory, inlined into the formatted config.
+		rules = append(rules,
+			configRule{Action: ruleDrop, Directive: "key"},
+			configRule{Action: ruleAppend, Line: "<key>\n" + strings.TrimSpace(key) + "\n</key>"},
+		)
+	}
+
+	openVPNArgs, err := extraOpenVPNArgs(awsclientConfig.profile(profile), c.Args().Slice())
+
+	if err != nil {
+		log.Fatal().Err(err).Str("profile", profile).Msg("Invalid extra openvpn arguments!")
+	}
+
+	sessionLog, err := startSessionLog(awsclientConfig.Vpn.User)
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed creating session log, the bundle command won't include logs from this session.")
+	} else {
+		log.Debug().Str("sessionLog", sessionLog).Msg("Recording session log")
+	}
+
+	err = verifyOpenVPNBinary(awsclientConfig.Vpn.OpenVPN)
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Refusing to connect with an unusable openvpn binary! Run the doctor command for details. " + errorSuffix)
+	}
+
+	var lock *os.File
+
+	if c.Bool("force") {
+		lock, err = forceProfileLock(awsclientConfig, profile, 30*time.Second)
+	} else {
+		lock, err = acquireProfileLock(profile)
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Str("profile", profile).Msg("Failed locking profile!")
+	}
+
+	registerCleanup(func() { lock.Close() })
+
+	sessionDir, err := createSessionDir(tmpOpenVPNConfigDir)
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating private session directory! " + errorSuffix)
+	}
+
+	// Formatted configs and auth files must never outlive the session.
+	registerCleanup(func() {
+		log.Debug().Str("dir", sessionDir).Msg("Removing session directory")
+		os.RemoveAll(sessionDir)
+	})
+	defer runCleanup()
+
 	log.Debug().
 		Str("config", openVPNConfig).
-		Str("configOutDir", tmpOpenVPNConfigDir).
+		Str("configOutDir", sessionDir).
 		Msg("Parsing openvpn config and saving formatted version for openvpn")
 
-	connectionConfig, err := parseAndFormatOpenVPNConfig(openVPNConfig, tmpOpenVPNConfigDir)
+	connectionConfig, err := parseAndFormatOpenVPNConfig(openVPNConfig, sessionDir, rules)
 
 	if err != nil {
 		log.Fatal().
 			Str("config", openVPNConfig).
-			Str("configOut", tmpOpenVPNConfigDir).
+			Str("configOut", sessionDir).
 			Err(err).
 			Msg("Failed parsing or saving formatted version openvpn config! " + errorSuffix)
 	}
@@ -76,15 +194,37 @@ func serveAction(c *cli.Context) error {
 		log.Info().Msg("Parsed openvpn configuration.")
 	}
 
+	authType, err := resolveAuthType(awsclientConfig.profile(profile).Auth, connectionConfig.AuthType)
+
+	if err != nil {
+		log.Fatal().Err(err).Str("profile", profile).Msg("Invalid auth in " + appName + " config!")
+	}
+
 	handle := &serveHandle{
 		Config:                  awsclientConfig,
+		ConfigFilename:          awsClientConfigFilename,
 		OpenVPNConnectionConfig: connectionConfig,
-		SAMLResponse:            make(chan string),
-		TempDir:                 tmpOpenVPNConfigDir,
+		SAMLResponse:            make(chan string, 1),
+		TempDir:                 sessionDir,
+		Profile:                 profile,
+		OpenVPNArgs:             openVPNArgs,
+		AuthType:                authType,
+		Secrets:                 secrets,
 	}
 
-	log.Info().Msgf("Starting HTTP server at: %s", handle.Config.Server.Addr)
-	go startSAMLServer(handle)
+	go handleSignals(handle)
+
+	// Only the SAML flow needs somewhere for the IdP to post its response to.
+	if authType == authSAML {
+		handle.loadRememberedSAML()
+
+		if _, err = samlServerPort(handle.Config.Server.Addr); err != nil {
+			log.Fatal().Err(err).Msg("Invalid SAML server address in " + appName + " config!")
+		}
+
+		log.Info().Msgf("Starting HTTP server at: %s", samlServerURL(handle.Config.Server))
+		go startSAMLServer(handle)
+	}
 
 	startOpenVPNConnection(handle)
 
@@ -106,45 +246,172 @@ func startOpenVPNConnection(handle *serveHandle) {
 		log.Fatal().Str("serviceHost", handle.ServiceHost).Err(err).Msg("Failed looking up ipv4 address of service hostname " + errorSuffix)
 	}
 
-	// Get the port of the SAML server for our password.
-	u, _ := url.Parse("http://" + handle.Config.Server.Addr)
-
-	// Save auth file for openvpn
-	tmpAuthConifg, err := saveOpenVPNAuthConfig(handle.TempDir, "ACS::"+u.Port())
+	handle.State, err = newSessionStateFile(sessionState{
+		Pid:          os.Getpid(),
+		Profile:      handle.Profile,
+		Status:       sessionStatusConnecting,
+		SessionDir:   handle.TempDir,
+		EndpointHost: handle.OpenVPNConnectionConfig.Host,
+		EndpointIP:   handle.ServiceIPv4,
+	})
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed saving openvpn auth config file! " + errorSuffix)
+		log.Fatal().Err(err).Msg("Failed writing session state file! " + errorSuffix)
 	}
 
-	log.Info().
-		Str("config", handle.OpenVPNConnectionConfig.Filename).
-		Str("remote", handle.ServiceIPv4).
-		Msg("Fetching redirect URL from service...")
+	registerCleanup(handle.State.Remove)
+
+	handle.emit(hookPreConnect)
+
+	for {
+		var username, password string
+		var reusedSAML bool
+
+		switch handle.AuthType {
+		case authSAML:
+			username, password, reusedSAML = samlCredentials(handle)
+		case authPassword:
+			username, password, err = passwordCredentials(handle.Config, handle.Secrets, handle.Profile)
+
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed getting username and password! " + errorSuffix)
+			}
+		}
+
+		connected, authFailed, err := runTunnel(handle, username, password)
+
+		// A SAML session ending needs a new SID, so we log in again, reusing the SAML response while it's valid.
+		// Other auth failures and openvpn exiting non-zero end the session with an error, a clean exit means we
+		// were stopped.
+		if !authFailed || handle.AuthType != authSAML {
+			if authFailed {
+				log.Fatal().Err(err).Msg("AWS rejected the credentials! " + errorSuffix)
+			}
+
+			if err != nil {
+				log.Fatal().Err(err).Msg("OpenVPN tunnel exited with an error! Please check its output above. " + errorSuffix)
+			}
+
+			return
+		}
+
+		switch {
+		case reusedSAML:
+			log.Info().Msg("AWS rejected the remembered SAML response, logging in again.")
+			handle.forgetSAML()
+		case connected:
+			log.Info().Msg("AWS ended the session, reconnecting.")
+		default:
+			log.Fatal().Msg("AWS rejected the SAML response! Please check the DEBUG logs for more information. " + errorSuffix)
+		}
+
+		handle.State.Update(func(s *sessionState) { s.Status = sessionStatusConnecting })
+	}
+}
+
+// runTunnel runs openvpn until it exits and reports whether it connected, whether it exited because
+// AWS rejected our credentials and its exit error. Failing to start openvpn at all is fatal.
+func runTunnel(handle *serveHandle, username, password string) (connected, authFailed bool, exitErr error) {
+	log.Info().Str("auth", handle.AuthType).Msg("Attempting to start OpenVPN client tunnel...")
 
-	command := exec.Command(
-		handle.Config.Vpn.OpenVPN,
-		"--verb", "3",
+	handle.tunnelMu.Lock()
+	handle.tunnelConnected, handle.tunnelAuthFailed = false, false
+	handle.tunnelMu.Unlock()
+
+	var mgmt *openVPNManagement
+	var err error
+
+	// Certificate authentication needs no credentials, openvpn never asks for them.
+	if handle.AuthType != authCertificate {
+		mgmt, err = listenForManagement(handle.TempDir)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed opening openvpn management socket for OpenVPN tunnel! " + errorSuffix)
+		}
+
+		// Closed when this attempt ends, a fatal exit leaves the socket to the session directory's removal.
+		defer mgmt.Close()
+
+		go func() {
+			if err := mgmt.ServeCredentials(username, password); err != nil {
+				log.Error().Err(err).Msg("Failed passing credentials to openvpn! " + errorSuffix)
+			}
+		}()
+	}
+
+	routes, err := routeArgs(handle.Config.profile(handle.Profile).Routes)
+
+	if err != nil {
+		log.Fatal().Err(err).Str("profile", handle.Profile).Msg("Invalid routes in " + appName + " config!")
+	}
+
+	args := []string{
 		"--config", handle.OpenVPNConnectionConfig.Filename,
 		"--proto", handle.OpenVPNConnectionConfig.Protocol,
 		"--remote", handle.ServiceIPv4, strconv.FormatInt(int64(handle.OpenVPNConnectionConfig.Port), 10),
-		"--auth-user-pass", tmpAuthConifg,
-	)
+		"--script-security", "2",
+		"--writepid", path.Join(handle.TempDir, openVPNPidFilename),
+	}
+
+	if mgmt != nil {
+		args = append(args, mgmt.Args()...)
+	}
+
+	args = append(args, openVPNScriptArgs(handle)...)
+	args = append(args, routes...)
+	args = append(args, handle.OpenVPNArgs...)
+	args = append(args, forcedOpenVPNArgs...)
+
+	baseCommand := exec.Command(handle.Config.Vpn.OpenVPN, args...)
+
+	tunnelCommand := withSudo(handle.Config, baseCommand)
+	tunnelCommand.Env = os.Environ()
+	tunnelCommand.Stdin = os.Stdin
+
+	log.Debug().Str("command", tunnelCommand.String()).Msg("Executing OpenVPN tunnel.")
+
+	exitErr = runWithOpenVPNLogging(tunnelCommand, handle.setTunnel, handle.onOpenVPNLine)
+
+	if _, exited := exitErr.(*exec.ExitError); exitErr != nil && !exited {
+		log.Fatal().Err(exitErr).Msg("Failed starting OpenVPN tunnel! " + errorSuffix)
+	}
+
+	handle.tunnelMu.Lock()
+	defer handle.tunnelMu.Unlock()
+
+	return handle.tunnelConnected, handle.tunnelAuthFailed, exitErr
+}
+
+// samlCredentials runs the federated login: openvpn fetches the IdP URL and a session ID from AWS, the user
+// logs in through their browser and the IdP posts the SAML response to our server. The second phase
+// authenticates with both.
+func samlCredentials(handle *serveHandle) (username, password string, reused bool) {
+	// AWS only gets the port of the SAML server, the scheme and host are part of the IdP's ACS URL.
+	port, _ := samlServerPort(handle.Config.Server.Addr)
 
-	out, err := command.CombinedOutput()
+	log.Info().
+		Str("config", handle.OpenVPNConnectionConfig.Filename).
+		Str("remote", handle.ServiceIPv4).
+		Msg("Fetching redirect URL from service...")
 
-	removeErr := os.Remove(tmpAuthConifg)
+	out, command, err := runOpenVPNChallenge(handle, "ACS::"+port)
 
-	if removeErr != nil {
-		log.Warn().Str("openvpnAuthConfig", tmpAuthConifg).Err(err).Msg("Failed deleting tmp openvpn auth config! " + errorSuffix)
+	if command != nil {
+		log.Debug().Str("command", command.String()).Str("payload", string(out)).Msg("Executed command")
 	}
 
-	log.Debug().Str("command", command.String()).Str("payload", string(out)).Msg("Executed command")
+	// openvpn exits with an error once AWS answers with the challenge, without one it couldn't start or
+	// died before getting that far.
+	if err != nil && !strings.Contains(string(out), "CRV1") {
+		log.Fatal().Err(err).Str("output", lastLines(string(out), 5)).Msg("Failed running openvpn to fetch redirect URL! " + errorSuffix)
+	}
 
 	// Now are must extract the URL from the payload. We use xurls to do this since regex is hard.
 	rxStrict := xurls.Strict()
 	foundURLs := rxStrict.FindAllString(string(out), -1)
 
 	if len(foundURLs) == 0 {
+		handle.emit(hookAuthFailed)
 		log.Fatal().Err(err).Msg("No URLs found in payload from server! Please check the DEBUG logs for more information. " + errorSuffix)
 	}
 
@@ -154,22 +421,40 @@ func startOpenVPNConnection(handle *serveHandle) {
 
 	authUrl := foundURLs[len(foundURLs)-1]
 
-	log.Info().Msgf("open to authenticate into OpenVPN tunnel: %s", authUrl)
+	var SAMLResponse string
+
+	if handle.cachedSAML.Valid() {
+		log.Info().Time("expiry", handle.cachedSAML.Expiry).Msg("Reusing SAML response from the last login.")
+		SAMLResponse, reused = handle.cachedSAML.Response, true
+	} else {
+		// An IdP with a live session can post back as soon as the browser opens, or even before the hook returns.
+		handle.expectSAMLResponse()
 
-	if handle.Config.Browser {
-		errOpenDefaultBrowser := openDefaultBrowser(handle.Config.Vpn.User, authUrl)
+		log.Info().Msgf("open to authenticate into OpenVPN tunnel: %s", authUrl)
+		handle.emit(hookAuthURLReady, "AWS_VPN_AUTH_URL="+authUrl)
 
-		if errOpenDefaultBrowser != nil {
-			log.Warn().Err(err).Msg("Failed opening default browser. Please use the provided link in the output")
+		if handle.Config.Browser.Enabled {
+			errOpenBrowser := openBrowser(handle.Config, authUrl)
+
+			if errOpenBrowser != nil {
+				log.Warn().Err(errOpenBrowser).Msg("Failed opening browser. Please use the provided link in the output")
+			}
 		}
-	}
 
-	log.Info().Msg("Waiting for SAML response from 3rd party service...")
-	SAMLResponse := <-handle.SAMLResponse
+		log.Info().Msg("Waiting for SAML response from 3rd party service...")
+		SAMLResponse = <-handle.SAMLResponse
 
-	log.Info().Msg("Received SAML response! Attempting to start OpenVPN client tunnel...")
+		log.Info().Msg("Received SAML response!")
 
-	// Save auth file for openvpn
+		handle.rememberSAML(SAMLResponse)
+	}
+
+	if handle.cachedSAML.Response == SAMLResponse {
+		expiry := handle.cachedSAML.Expiry
+		handle.State.Update(func(s *sessionState) { s.SAMLExpiry = &expiry })
+	}
+
+	// The session ID ties the second phase to the challenge AWS answered.
 	SID, err := extractSIDFromOpenVPN(string(out))
 
 	if err != nil {
@@ -177,104 +462,157 @@ func startOpenVPNConnection(handle *serveHandle) {
 	}
 
 	escapedSAMLResponse := url.QueryEscape(SAMLResponse)
-	log.Debug().Str("SAMLResponse", escapedSAMLResponse).Msgf("writing temp openvpn auth file")
-	tmpAuthConifg, err = saveOpenVPNAuthConfig(handle.TempDir, "CRV1::"+SID+"::"+escapedSAMLResponse)
+	log.Debug().Str("SAMLResponse", escapedSAMLResponse).Msg("Passing SAML response to openvpn over management interface")
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed saving auth config for OpenVPN tunnel! " + errorSuffix)
-	}
+	return "N/A", "CRV1::" + SID + "::" + escapedSAMLResponse, reused
+}
 
-	baseCommand := exec.Command(
-		handle.Config.Vpn.OpenVPN,
-		"--verb", "3",
-		"--config", handle.OpenVPNConnectionConfig.Filename,
-		"--proto", handle.OpenVPNConnectionConfig.Protocol,
-		"--remote", handle.ServiceIPv4, strconv.FormatInt(int64(handle.OpenVPNConnectionConfig.Port), 10),
-		"--script-security", "2",
-		"--auth-user-pass", tmpAuthConifg,
-	)
+// rememberSAML keeps a SAML response for reconnects, in the secret store too if configured.
+func (handle *serveHandle) rememberSAML(SAMLResponse string) {
+	expiry, err := parseSAMLExpiry(SAMLResponse)
 
-	// If the user didn't provide a shell or we are already running as root.
-	// Non special hacks are needed to to run this step.
-	if handle.Config.Vpn.Shell == "" || isRoot() {
-		baseCommand.Env = os.Environ()
-		baseCommand.Stdout = os.Stdout
-		baseCommand.Stderr = os.Stderr
-		baseCommand.Stdin = os.Stdin
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed reading expiry from SAML response, it won't be reused")
+		handle.cachedSAML = cachedSAML{}
 
-		log.Debug().Str("command", baseCommand.String()).Msg("Executing OpenVPN tunnel.")
+		return
+	}
 
-		err = baseCommand.Start()
-		baseCommand.Wait()
-	} else {
+	handle.cachedSAML = cachedSAML{Response: SAMLResponse, Expiry: expiry}
 
-		args := append(handle.Config.Vpn.ShellArgs, handle.Config.Vpn.Sudo+" "+baseCommand.String())
+	if handle.Config.Secrets.RememberSAML && handle.Secrets != nil {
+		if err = handle.Secrets.Set(samlSecretName(handle.Profile), SAMLResponse); err != nil {
+			log.Warn().Err(err).Msg("Failed saving SAML response to secret store")
+		}
+	}
+}
 
-		shellCommand := exec.Command(
-			handle.Config.Vpn.Shell,
-			args...,
-		)
+// forgetSAML drops a SAML response AWS didn't accept.
+func (handle *serveHandle) forgetSAML() {
+	handle.cachedSAML = cachedSAML{}
 
-		shellCommand.Env = os.Environ()
-		shellCommand.Stdout = os.Stdout
-		shellCommand.Stderr = os.Stderr
-		shellCommand.Stdin = os.Stdin
+	if handle.Config.Secrets.RememberSAML && handle.Secrets != nil {
+		if err := handle.Secrets.Delete(samlSecretName(handle.Profile)); err != nil && err != errSecretNotFound {
+			log.Warn().Err(err).Msg("Failed removing SAML response from secret store")
+		}
+	}
+}
 
-		log.Debug().Str("command", shellCommand.String()).Msg("Executing OpenVPN tunnel in shell.")
+// loadRememberedSAML picks up the SAML response an earlier session saved to the secret store.
+func (handle *serveHandle) loadRememberedSAML() {
+	if !handle.Config.Secrets.RememberSAML || handle.Secrets == nil {
+		return
+	}
 
-		err = shellCommand.Start()
+	SAMLResponse, err := handle.Secrets.Get(samlSecretName(handle.Profile))
 
-		shellCommand.Wait()
+	if err != nil {
+		if err != errSecretNotFound {
+			log.Warn().Err(err).Msg("Failed reading SAML response from secret store")
+		}
+
+		return
 	}
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed starting OpenVPN tunnel! " + errorSuffix)
+	if expiry, err := parseSAMLExpiry(SAMLResponse); err == nil {
+		handle.cachedSAML = cachedSAML{Response: SAMLResponse, Expiry: expiry}
 	}
 }
 
-func startSAMLServer(handle *serveHandle) {
-	http.HandleFunc("/", SAMLServer(handle))
-	http.ListenAndServe(handle.Config.Server.Addr, nil)
-}
+// runOpenVPNChallenge connects with the first phase password and returns openvpn's output,
+// which holds the SAML redirect URL and the session ID for the second phase, and how it exited.
+func runOpenVPNChallenge(handle *serveHandle, password string) (out []byte, command *exec.Cmd, err error) {
+	mgmt, err := listenForManagement(handle.TempDir)
 
-func writeEmbededHtmlFile(file embed.FS, filePath string, w http.ResponseWriter) {
-	content, err := file.ReadFile(filePath)
 	if err != nil {
-		log.Error().Msgf("failed loading HTML file: %s", filePath)
-		http.Error(w, "Could not load HTML file", http.StatusInternalServerError)
 		return
 	}
 
-	w.Write(content)
+	defer mgmt.Close()
+
+	go func() {
+		if err := mgmt.ServeCredentials("N/A", password); err != nil {
+			log.Error().Err(err).Msg("Failed passing credentials to openvpn! " + errorSuffix)
+		}
+	}()
+
+	args := []string{
+		"--config", handle.OpenVPNConnectionConfig.Filename,
+		"--proto", handle.OpenVPNConnectionConfig.Protocol,
+		"--remote", handle.ServiceIPv4, strconv.FormatInt(int64(handle.OpenVPNConnectionConfig.Port), 10),
+	}
+	args = append(args, mgmt.Args()...)
+	args = append(args, handle.OpenVPNArgs...)
+	args = append(args, forcedOpenVPNArgs...)
+
+	command = exec.Command(handle.Config.Vpn.OpenVPN, args...)
+
+	// openvpn exits with an error even when AWS answered with the challenge, so callers look at out too.
+	out, err = command.CombinedOutput()
+
+	return
 }
 
-func SAMLServer(handle *serveHandle) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		w.Header().Set("Content-Type", "text/html")
-		switch r.Method {
-		case "POST":
-			if err := r.ParseForm(); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				writeEmbededHtmlFile(errorHtmlFile, "html/error.html", w)
-				log.Error().Err(err).Msg("ParseForm() returned unexpected error")
-				return
-			}
+// onOpenVPNLine keeps the session state up to date and fires hooks for events openvpn doesn't run scripts for.
+// Connects and disconnects are announced by the hook command openvpn runs as its up and down script.
+func (handle *serveHandle) onOpenVPNLine(line string) {
+	handle.State.TrackOpenVPNLine(line)
+
+	event := detectOpenVPNEvent(line)
+
+	switch event {
+	case hookConnected:
+		handle.tunnelMu.Lock()
+		handle.tunnelConnected = true
+		handle.tunnelMu.Unlock()
+	case hookAuthFailed:
+		handle.tunnelMu.Lock()
+		handle.tunnelAuthFailed = true
+		handle.tunnelMu.Unlock()
+	}
 
-			SAMLResponse := r.FormValue("SAMLResponse")
-			if len(SAMLResponse) == 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				writeEmbededHtmlFile(errorHtmlFile, "html/error.html", w)
-				log.Error().Msg("SAMLResponse field empty")
-				return
-			}
+	switch event {
+	case hookReconnecting, hookAuthFailed:
+		handle.emit(event)
+	}
+}
 
-			handle.SAMLResponse <- SAMLResponse
-			writeEmbededHtmlFile(welcomeHtmlFile, "html/index.html", w)
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			writeEmbededHtmlFile(errorHtmlFile, "html/error.html", w)
-			log.Error().Msgf("Error: POST method expected, %s received", r.Method)
+// emit announces a lifecycle event through the configured hook and, if enabled, a desktop notification.
+func (handle *serveHandle) emit(event string, extraEnv ...string) {
+	announceEvent(handle.Config, event, handle.State.Snapshot(), extraEnv...)
+}
+
+func (handle *serveHandle) setTunnel(p *os.Process) {
+	handle.tunnelMu.Lock()
+	defer handle.tunnelMu.Unlock()
+
+	handle.tunnel = p
+
+	// p is sudo when openvpn runs through it, the up script records openvpn's own pid from its --writepid file.
+	if p == nil && handle.State != nil {
+		handle.State.Update(func(s *sessionState) { s.OpenVPNPid = 0 })
+	}
+}
+
+// handleSignals forwards interrupts to a running tunnel so openvpn can tear down routes before we
+// clean up. Without a tunnel there's nothing to wait for, so we clean up and exit right away.
+func handleSignals(handle *serveHandle) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	for sig := range signals {
+		handle.tunnelMu.Lock()
+		tunnel := handle.tunnel
+		handle.tunnelMu.Unlock()
+
+		if tunnel != nil {
+			log.Info().Str("signal", sig.String()).Msg("Stopping OpenVPN tunnel...")
+			tunnel.Signal(sig)
+			continue
 		}
+
+		log.Info().Str("signal", sig.String()).Msg("Interrupted, cleaning up.")
+		runCleanup()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sessionDirPrefix = "session-"
+)
+
+type (
+	// fatalCleanupHook runs registered cleanups before log.Fatal exits the process, since os.Exit skips defers.
+	fatalCleanupHook struct{}
+)
+
+var (
+	cleanupMu    sync.Mutex
+	cleanupFuncs []func()
+)
+
+// registerCleanup schedules f to run on shutdown, including shutdowns caused by log.Fatal or signals.
+func registerCleanup(f func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+
+	cleanupFuncs = append(cleanupFuncs, f)
+}
+
+// runCleanup runs registered cleanups in reverse order. Each one only ever runs once.
+func runCleanup() {
+	cleanupMu.Lock()
+	funcs := cleanupFuncs
+	cleanupFuncs = nil
+	cleanupMu.Unlock()
+
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+}
+
+func (fatalCleanupHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level == zerolog.FatalLevel {
+		runCleanup()
+	}
+}
+
+// ensurePrivateDir creates dir if needed and makes sure nobody but us can get into it.
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		return fmt.Errorf("'%s' is owned by another user", dir)
+	}
+
+	if info.Mode().Perm() != 0700 {
+		return os.Chmod(dir, 0700)
+	}
+
+	return nil
+}
+
+// getRuntimeDir returns the private directory holding session files, locks and state.
+// Lives under $XDG_RUNTIME_DIR when available so it's wiped on logout, otherwise in the temp dir.
+func getRuntimeDir() (dir string, err error) {
+	if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
+		dir = path.Join(xdg, defaultConfigDirectoryName)
+	} else {
+		dir = path.Join(os.TempDir(), defaultConfigDirectoryName+"-"+strconv.Itoa(os.Geteuid()))
+	}
+
+	err = ensurePrivateDir(dir)
+
+	return
+}
+
+// createSessionDir makes a fresh private directory for one serve run inside parent, or the runtime dir
+// when parent is empty. Leftovers from sessions that died without cleaning up are removed first.
+// A parent given by the user, e.g. /tmp, is shared with others so only the session directory is locked down.
+func createSessionDir(parent string) (dir string, err error) {
+	if parent == "" {
+		parent, err = getRuntimeDir()
+	} else if info, statErr := os.Stat(parent); statErr != nil {
+		err = statErr
+	} else if !info.IsDir() {
+		err = fmt.Errorf("'%s' is not a directory", parent)
+	}
+
+	if err != nil {
+		return
+	}
+
+	removeStaleSessionDirs(parent)
+
+	dir, err = os.MkdirTemp(parent, sessionDirPrefix+strconv.Itoa(os.Getpid())+"-*")
+
+	if err != nil {
+		return
+	}
+
+	err = os.Chmod(dir, 0700)
+
+	return
+}
+
+func removeStaleSessionDirs(parent string) {
+	entries, err := os.ReadDir(parent)
+
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), sessionDirPrefix) {
+			continue
+		}
+
+		tokens := strings.SplitN(strings.TrimPrefix(e.Name(), sessionDirPrefix), "-", 2)
+		pid, err := strconv.Atoi(tokens[0])
+
+		if err != nil || processAlive(pid) {
+			continue
+		}
+
+		log.Debug().Str("dir", e.Name()).Msg("Removing stale session directory")
+		os.RemoveAll(path.Join(parent, e.Name()))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -18,7 +19,6 @@ const (
 )
 
 var (
-	OpenVPNPatchScript      = path.Join("scripts", "openvpn-v2.5.1-aws.patch")
 	OpenVPNConfigureOptions = []string{
 		"--disable-debug",
 		"--disable-dependency-tracking",
@@ -70,18 +70,26 @@ func setupAction(c *cli.Context) error {
 		return fmt.Errorf("one or more commands not found")
 	}
 
+	var patch []byte
+	var err error
+
+	// Fall back to the patch compiled into the binary so setup works from any directory.
 	if patchFile == "" {
-		patchFile = OpenVPNPatchScript
+		log.Debug().Str("patch", defaultPatchName).Msg("Using embedded patch")
+		patch, err = readEmbeddedPatch(defaultPatchName)
+	} else {
+		patch, err = os.ReadFile(patchFile)
 	}
 
-	if !fileExists(patchFile) {
-		log.Error().Msgf("Patch file '%s' not found! Please use -p to define a patch file! "+errorSuffix, patchFile)
+	if err != nil {
+		log.Error().Err(err).Msgf("Patch file '%s' not found! Please use -p to define a patch file! "+errorSuffix, patchFile)
+		return fmt.Errorf("patch not found")
 	}
 
 	if sourceDir == "" {
 		log.Info().Msgf("Downloading and extracing %s...", OpenVPNSourceFolderName)
 		tempDir := os.TempDir()
-		err := downloadOpenVPN(tempDir)
+		err = downloadOpenVPN(tempDir)
 
 		if err != nil {
 			return fmt.Errorf("failed downloading OpenVPN")
@@ -98,7 +106,7 @@ func setupAction(c *cli.Context) error {
 	}
 
 	log.Info().Msgf("Applying patch %s...", sourceDir)
-	err := patchOpenVPN(sourceDir, patchFile)
+	err = patchOpenVPN(sourceDir, patch)
 	if err != nil {
 		return fmt.Errorf("failed patching OpenVPN source code")
 	}
@@ -137,10 +145,11 @@ func extractTarFile(filename, dir string) error {
 	return nil
 }
 
-func patchOpenVPN(source, patchFilename string) error {
-	log.Debug().Msgf("Running 'patch -p 1 -d %s < %s'", source, patchFilename)
-	cmd := exec.Command("/bin/bash", "-c", "/usr/bin/patch -p 1 -d "+source+" < "+patchFilename)
+func patchOpenVPN(source string, patch []byte) error {
+	log.Debug().Msgf("Running 'patch -p 1 -d %s'", source)
+	cmd := exec.Command("patch", "-p", "1", "-d", source)
 	cmd.Env = os.Environ()
+	cmd.Stdin = bytes.NewReader(patch)
 
 	out, err := cmd.CombinedOutput()
 
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	sessionStateSuffix = ".state.json"
+	sessionLockSuffix  = ".lock"
+
+	sessionStatusConnecting   = "connecting"
+	sessionStatusConnected    = "connected"
+	sessionStatusDisconnected = "disconnected"
+	sessionStatusStale        = "stale"
+)
+
+type (
+	// sessionState is what a running serve knows about its tunnel, persisted in the runtime dir
+	// so other invocations can inspect it without talking to the process.
+	sessionState struct {
+		Pid            int        `json:"pid"`
+		OpenVPNPid     int        `json:"openvpnPid,omitempty"`
+		Profile        string     `json:"profile"`
+		Status         string     `json:"status"`
+		SessionDir     string     `json:"sessionDir"`
+		EndpointHost   string     `json:"endpointHost"`
+		EndpointIP     string     `json:"endpointIp"`
+		TunDevice      string     `json:"tunDevice,omitempty"`
+		AssignedIP     string     `json:"assignedIp,omitempty"`
+		Routes         []string   `json:"routes,omitempty"`
+		ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+		SAMLExpiry     *time.Time `json:"samlExpiry,omitempty"`
+	}
+
+	// sessionStateFile serializes updates to a session's state file.
+	sessionStateFile struct {
+		filename string
+		mu       sync.Mutex
+		state    sessionState
+	}
+)
+
+var (
+	profileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+	tunDeviceRegex  = regexp.MustCompile(`TUN/TAP device (\S+) opened`)
+	assignedIPRegex = regexp.MustCompile(`(?:net_addr_v4_add: |ip addr add dev \S+ (?:local )?|ifconfig \S+ )(\d+\.\d+\.\d+\.\d+)`)
+	routeRegex      = regexp.MustCompile(`(?:net_route_v4_add: |ip route add )(\d+\.\d+\.\d+\.\d+/\d+)`)
+)
+
+// profileNameFromConfig derives a profile name from an .ovpn filename, e.g. /a/prod.ovpn becomes prod.
+func profileNameFromConfig(filename string) string {
+	return sanitizeProfileName(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+}
+
+func sanitizeProfileName(name string) string {
+	name = strings.Trim(profileNameRegex.ReplaceAllString(name, "-"), "-.")
+
+	if name == "" {
+		return "default"
+	}
+
+	return name
+}
+
+func sessionStateFilename(profile string) (filename string, err error) {
+	dir, err := getRuntimeDir()
+
+	if err != nil {
+		return
+	}
+
+	return path.Join(dir, sanitizeProfileName(profile)+sessionStateSuffix), nil
+}
+
+// lockSessionState takes an flock on the lock file next to a state file, shared for reading or exclusive
+// for read-modify-write. serve and the hook processes openvpn runs as root update the same file.
+func lockSessionState(filename string, how int) (unlock func(), err error) {
+	lockFilename := filename + sessionLockSuffix
+
+	// Read-only is enough for flock and works for the user on a lock file root created.
+	f, err := os.OpenFile(lockFilename, os.O_CREATE|os.O_RDONLY, 0600)
+
+	if err != nil {
+		return
+	}
+
+	if isRoot() {
+		chownToDirOwner(lockFilename)
+	}
+
+	if err = syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// chownToDirOwner hands a file root created in the runtime dir back to whoever owns that dir.
+func chownToDirOwner(filename string) {
+	if info, err := os.Stat(path.Dir(filename)); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			os.Chown(filename, int(stat.Uid), int(stat.Gid))
+		}
+	}
+}
+
+// readSessionState reads a state file without locking, callers hold its lock.
+func readSessionState(filename string) (state *sessionState, err error) {
+	content, err := os.ReadFile(filename)
+
+	if err != nil {
+		return
+	}
+
+	state = &sessionState{}
+	err = json.Unmarshal(content, state)
+
+	return
+}
+
+// loadSessionState reads a state file under a shared lock, so it never sees one half way through an update.
+func loadSessionState(filename string) (state *sessionState, err error) {
+	unlock, err := lockSessionState(filename, syscall.LOCK_SH)
+
+	if err != nil {
+		return
+	}
+
+	defer unlock()
+
+	return readSessionState(filename)
+}
+
+// listSessionStates reads every state file in the runtime dir, marking ones whose serve process is gone as stale.
+func listSessionStates() (states []*sessionState, err error) {
+	dir, err := getRuntimeDir()
+
+	if err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return
+	}
+
+	states = []*sessionState{}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), sessionStateSuffix) {
+			continue
+		}
+
+		state, readErr := loadSessionState(path.Join(dir, e.Name()))
+
+		if readErr != nil {
+			continue
+		}
+
+		if !processAlive(state.Pid) {
+			state.Status = sessionStatusStale
+		}
+
+		states = append(states, state)
+	}
+
+	return
+}
+
+func findSessionState(profile string) (state *sessionState, err error) {
+	filename, err := sessionStateFilename(profile)
+
+	if err != nil {
+		return
+	}
+
+	state, err = loadSessionState(filename)
+
+	if err != nil {
+		return
+	}
+
+	if !processAlive(state.Pid) {
+		state.Status = sessionStatusStale
+	}
+
+	return
+}
+
+func newSessionStateFile(state sessionState) (f *sessionStateFile, err error) {
+	filename, err := sessionStateFilename(state.Profile)
+
+	if err != nil {
+		return
+	}
+
+	f = &sessionStateFile{filename: filename, state: state}
+
+	unlock, err := lockSessionState(filename, syscall.LOCK_EX)
+
+	if err != nil {
+		return
+	}
+
+	defer unlock()
+
+	err = f.write()
+
+	return
+}
+
+// openSessionStateFile loads an existing state file, used by processes other than the session's serve.
+func openSessionStateFile(filename string) (f *sessionStateFile, err error) {
+	state, err := loadSessionState(filename)
+
+	if err != nil {
+		return
+	}
+
+	return &sessionStateFile{filename: filename, state: *state}, nil
+}
+
+// write replaces the state file atomically so readers never see a partial file. Callers hold mu and
+// the file's exclusive lock.
+func (f *sessionStateFile) write() error {
+	content, err := json.MarshalIndent(f.state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(f.filename, content, 0600); err != nil {
+		return err
+	}
+
+	// openvpn's scripts update the state as root, hand the file back to whoever owns the runtime dir.
+	// Readers wait for our lock, so they never find it owned by root.
+	if isRoot() {
+		chownToDirOwner(f.filename)
+	}
+
+	return nil
+}
+
+// Update applies fn to the state and persists the result. The file is re-read under an exclusive lock
+// first since openvpn's scripts update it from another process.
+func (f *sessionStateFile) Update(fn func(*sessionState)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unlock, err := lockSessionState(f.filename, syscall.LOCK_EX)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if state, err := readSessionState(f.filename); err == nil {
+		f.state = *state
+	}
+
+	fn(&f.state)
+
+	return f.write()
+}
+
+// TrackOpenVPNLine picks tunnel details out of openvpn's log output.
+func (f *sessionStateFile) TrackOpenVPNLine(line string) {
+	if m := tunDeviceRegex.FindStringSubmatch(line); m != nil {
+		f.Update(func(s *sessionState) { s.TunDevice = m[1] })
+	}
+
+	if m := assignedIPRegex.FindStringSubmatch(line); m != nil {
+		f.Update(func(s *sessionState) { s.AssignedIP = m[1] })
+	}
+
+	if m := routeRegex.FindStringSubmatch(line); m != nil {
+		f.Update(func(s *sessionState) { s.Routes = append(s.Routes, m[1]) })
+	}
+
+	if strings.Contains(line, "Initialization Sequence Completed") {
+		now := time.Now()
+		f.Update(func(s *sessionState) {
+			s.Status = sessionStatusConnected
+			s.ConnectedSince = &now
+		})
+	}
+}
+
+// Snapshot returns a copy of the current state.
+func (f *sessionStateFile) Snapshot() sessionState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if state, err := loadSessionState(f.filename); err == nil {
+		f.state = *state
+	}
+
+	state := f.state
+	state.Routes = append([]string{}, f.state.Routes...)
+
+	return state
+}
+
+func (f *sessionStateFile) Remove() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if unlock, err := lockSessionState(f.filename, syscall.LOCK_EX); err == nil {
+		os.Remove(f.filename)
+		os.Remove(f.filename + sessionLockSuffix)
+		unlock()
+		return
+	}
+
+	os.Remove(f.filename)
+}
+
+func printSessionState(state *sessionState) {
+	fmt.Printf("%s: %s\n", state.Profile, state.Status)
+	fmt.Printf("  pid:         %d\n", state.Pid)
+	fmt.Printf("  endpoint:    %s (%s)\n", state.EndpointHost, state.EndpointIP)
+
+	if state.TunDevice != "" {
+		fmt.Printf("  device:      %s\n", state.TunDevice)
+	}
+
+	if state.AssignedIP != "" {
+		fmt.Printf("  address:     %s\n", state.AssignedIP)
+	}
+
+	if state.ConnectedSince != nil {
+		fmt.Printf("  connected:   %s (%s)\n", state.ConnectedSince.Format(time.RFC3339), time.Since(*state.ConnectedSince).Round(time.Second))
+	}
+
+	if state.SAMLExpiry != nil {
+		fmt.Printf("  saml expiry: %s\n", state.SAMLExpiry.Format(time.RFC3339))
+	}
+}
+
+// statusAction prints the state of one or all sessions. Exits non-zero when nothing is connected,
+// so it can be used in shell prompts and scripts.
+func statusAction(c *cli.Context) error {
+	states := []*sessionState{}
+
+	if profile := c.Args().First(); profile != "" {
+		state, err := findSessionState(profile)
+
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no session found for profile '%s'", profile)
+		} else if err != nil {
+			return err
+		}
+
+		states = append(states, state)
+	} else {
+		var err error
+		states, err = listSessionStates()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("json") {
+		content, err := json.MarshalIndent(states, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(content))
+	} else if len(states) == 0 {
+		fmt.Println("no sessions")
+	} else {
+		for _, state := range states {
+			printSessionState(state)
+		}
+	}
+
+	for _, state := range states {
+		if state.Status == sessionStatusConnected {
+			return nil
+		}
+	}
+
+	return cli.Exit("", 1)
+}
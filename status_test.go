@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSessionStateConcurrentUpdates(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	serve, err := newSessionStateFile(sessionState{Profile: "prod", Status: sessionStatusConnecting})
+
+	if err != nil {
+		t.Fatalf("newSessionStateFile: %v", err)
+	}
+
+	// A second handle on the same file stands in for the hook process openvpn runs.
+	hook, err := openSessionStateFile(serve.filename)
+
+	if err != nil {
+		t.Fatalf("openSessionStateFile: %v", err)
+	}
+
+	const updates = 50
+
+	var wg sync.WaitGroup
+
+	for _, f := range []*sessionStateFile{serve, hook} {
+		wg.Add(1)
+
+		go func(f *sessionStateFile) {
+			defer wg.Done()
+
+			for i := 0; i < updates; i++ {
+				if err := f.Update(func(s *sessionState) { s.Routes = append(s.Routes, strconv.Itoa(i)) }); err != nil {
+					t.Errorf("Update: %v", err)
+					return
+				}
+			}
+		}(f)
+	}
+
+	wg.Wait()
+
+	if got := len(serve.Snapshot().Routes); got != 2*updates {
+		t.Errorf("got %d routes after concurrent updates, want %d", got, 2*updates)
+	}
+
+	serve.Remove()
+
+	if fileExists(serve.filename) || fileExists(serve.filename+sessionLockSuffix) {
+		t.Errorf("Remove left %s or its lock file behind", serve.filename)
+	}
+}
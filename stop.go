@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	openVPNPidFilename = "openvpn.pid"
+)
+
+// readOpenVPNPid returns the pid openvpn wrote with --writepid into the session's directory.
+func readOpenVPNPid(state *sessionState) (pid int, err error) {
+	content, err := os.ReadFile(path.Join(state.SessionDir, openVPNPidFilename))
+
+	if err != nil {
+		return
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// signalOpenVPN sends SIGTERM to openvpn, elevating through withSudo like serve does when it runs as another user.
+func signalOpenVPN(c *config, pid int) error {
+	err := syscall.Kill(pid, syscall.SIGTERM)
+
+	if err != syscall.EPERM {
+		return err
+	}
+
+	if c == nil || c.Vpn.Shell == "" {
+		return fmt.Errorf("not permitted to signal openvpn (pid %d), run stop as root or configure vpn.shell and vpn.sudo", pid)
+	}
+
+	cmd := withSudo(c, exec.Command("kill", "-TERM", strconv.Itoa(pid)))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Debug().Str("command", cmd.String()).Msg("Signaling openvpn through sudo")
+
+	return cmd.Run()
+}
+
+func waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return true
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	return !processAlive(pid)
+}
+
+// removeSessionFiles deletes what a session left behind when its serve process couldn't clean up itself.
+func removeSessionFiles(state *sessionState) {
+	if state.SessionDir != "" {
+		os.RemoveAll(state.SessionDir)
+	}
+
+	if filename, err := sessionStateFilename(state.Profile); err == nil {
+		os.Remove(filename)
+		os.Remove(filename + sessionLockSuffix)
+	}
+}
+
+// selectSession picks the session named by profile, or the only one running when profile is empty.
+func selectSession(profile string) (*sessionState, error) {
+	if profile != "" {
+		state, err := findSessionState(profile)
+
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no session found for profile '%s'", profile)
+		}
+
+		return state, err
+	}
+
+	states, err := listSessionStates()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(states) {
+	case 0:
+		return nil, fmt.Errorf("no sessions running")
+	case 1:
+		return states[0], nil
+	}
+
+	var names []string
+	for _, s := range states {
+		names = append(names, s.Profile)
+	}
+
+	return nil, fmt.Errorf("more than one session running, please name one of: %s", strings.Join(names, ", "))
+}
+
+// stopSession tears down a session: openvpn is asked to exit so it can remove its routes, then we wait
+// for serve to notice and clean up after itself, stepping in when it doesn't.
+func stopSession(c *config, state *sessionState, timeout time.Duration) error {
+	if state.Status == sessionStatusStale {
+		log.Info().Str("profile", state.Profile).Msg("Session is no longer running, removing leftover files.")
+		removeSessionFiles(state)
+		return nil
+	}
+
+	openVPNPid, err := readOpenVPNPid(state)
+
+	if err == nil && processAlive(openVPNPid) {
+		log.Info().Str("profile", state.Profile).Int("pid", openVPNPid).Msg("Stopping OpenVPN tunnel...")
+
+		if err = signalOpenVPN(c, openVPNPid); err != nil {
+			return fmt.Errorf("failed signaling openvpn: %w", err)
+		}
+	} else {
+		// No tunnel yet, most likely still waiting for the SAML response.
+		log.Info().Str("profile", state.Profile).Int("pid", state.Pid).Msg("Stopping session...")
+
+		if err = syscall.Kill(state.Pid, syscall.SIGTERM); err != nil {
+			return fmt.Errorf("failed signaling %s: %w", appName, err)
+		}
+	}
+
+	if !waitForProcessExit(state.Pid, timeout) {
+		log.Warn().Int("pid", state.Pid).Msg("Session didn't exit in time, terminating it.")
+		syscall.Kill(state.Pid, syscall.SIGKILL)
+		waitForProcessExit(state.Pid, time.Second)
+	}
+
+	removeSessionFiles(state)
+
+	log.Info().Str("profile", state.Profile).Msg("Stopped.")
+
+	return nil
+}
+
+// stopAction stops a running tunnel by profile name.
+func stopAction(c *cli.Context) error {
+	state, err := selectSession(c.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	// Only needed to go through sudo, so stopping still works without a config.
+	var awsclientConfig *config
+
+	if filename, err := searchConfigFilename(); err == nil {
+		awsclientConfig, _ = loadConfig(filename)
+	}
+
+	return stopSession(awsclientConfig, state, c.Duration("timeout"))
+}
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"os/user"
 	"path"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -37,29 +38,37 @@ func copyFile(source, dest string) error {
 	return destFile.Sync()
 }
 
+// processAlive reports whether a process with pid exists, even if it belongs to another user.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || err == syscall.EPERM
+}
+
 func isRoot() bool {
 	return syscall.Geteuid() == 0
 }
 
-func openDefaultBrowser(defaultUser, url string) (err error) {
-	switch runtime.GOOS {
-	case "linux":
-		err = commandAndStartAsNonRoot(defaultUser, "xdg-open", url)
-	case "darwin":
-		err = commandAndStartAsNonRoot(defaultUser, "open", url)
-	default:
-		err = fmt.Errorf("unsupported platform %s", runtime.GOOS)
-	}
+// commandExists looks command up in $PATH without a shell, it comes from $BROWSER and the config.
+func commandExists(command string) bool {
+	_, err := exec.LookPath(command)
 
-	return
+	return err == nil
 }
 
-func commandExists(command string) bool {
-	cmd := exec.Command("/bin/sh", "-c", "command -v "+command)
-	if err := cmd.Run(); err != nil {
-		return false
+// lastLines returns at most the last n lines of s, for error messages about long command output.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
-	return true
+
+	return strings.Join(lines, "\n")
 }
 
 func fileExists(filename string) bool {
@@ -70,6 +79,23 @@ func fileExists(filename string) bool {
 	return false
 }
 
+// writeFileAtomic replaces filename with content, never leaving a partially written file behind.
+func writeFileAtomic(filename string, content []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the mode of an existing file.
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
+
 func getHomeDirConfigPath() (foldername string, err error) {
 	home, err := os.UserHomeDir()
 
@@ -150,37 +176,167 @@ func extractSIDFromOpenVPN(output string) (SID string, err error) {
 	return
 }
 
+// withSudo wraps cmd in the configured shell and sudo command so it runs with root privileges.
+// If the user didn't provide a shell or we are already running as root, no special hacks are
+// needed and cmd is returned as is.
+func withSudo(c *config, cmd *exec.Cmd) *exec.Cmd {
+	if c.Vpn.Shell == "" || isRoot() {
+		return cmd
+	}
+
+	quoted := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		quoted[i] = shellQuote(arg)
+	}
+
+	// exec.Command resolved the binary already, run exactly that.
+	quoted[0] = shellQuote(cmd.Path)
+
+	args := append(append([]string{}, c.Vpn.ShellArgs...), c.Vpn.Sudo+" "+strings.Join(quoted, " "))
+
+	wrapped := exec.Command(c.Vpn.Shell, args...)
+	wrapped.Stdin = cmd.Stdin
+
+	return wrapped
+}
+
+// shellQuote quotes s for /bin/sh when it contains anything the shell would interpret.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
 // shorthand for exec.Command(command, args...).Start() except it does SysProcAttr and Env injection
 // to ensure web browsers can safely startup.
 //
 // - defaultUser Should only be filled if for some reason the SUDO_USER env variable wont exist.
 // - command Binary we want to execute.
 func commandAndStartAsNonRoot(defaultUser string, command string, args ...string) error {
+	cmd, err := commandAsNonRoot(defaultUser, command, args...)
+	if err != nil {
+		return err
+	}
 
-	// If we aren't running as root. We just run exec.Command normally.
-	if !isRoot() {
-		return exec.Command(command, args...).Start()
+	// Start the command as the non-root user
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
 	}
 
+	return nil
+}
+
+// commandAsNonRoot prepares exec.Command(command, args...) to run as the user who invoked us,
+// dropping root privileges and fixing up the environment when we run under sudo.
+// cmd.Env is always set, so callers can append to it.
+// lookupNonRootUser returns who invoked us through sudo, or defaultUser, when we're running as root.
+// It's nil when we aren't root or root is who invoked us.
+func lookupNonRootUser(defaultUser string) (*user.User, error) {
 	userName := os.Getenv("SUDO_USER")
 	if userName == "" {
 		userName = defaultUser
 	}
 
-	// Get the user information for the non-root user (e.g., the user running the app initially)
-	nonRootUser, err := user.Lookup(userName) // Replace "your_username" with the actual user
+	if !isRoot() || userName == "" {
+		return nil, nil
+	}
+
+	nonRootUser, err := user.Lookup(userName)
 	if err != nil {
-		return fmt.Errorf("failed to lookup user: %w", err)
+		return nil, fmt.Errorf("failed to lookup user: %w", err)
 	}
 
-	// Parse the UID and GID of the non-root user
-	uid, err := strconv.Atoi(nonRootUser.Uid)
+	return nonRootUser, nil
+}
+
+func userIDs(u *user.User) (uid, gid int, err error) {
+	uid, err = strconv.Atoi(u.Uid)
 	if err != nil {
-		return fmt.Errorf("failed to parse UID: %w", err)
+		return 0, 0, fmt.Errorf("failed to parse UID: %w", err)
 	}
-	gid, err := strconv.Atoi(nonRootUser.Gid)
+
+	gid, err = strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse GID: %w", err)
+	}
+
+	return
+}
+
+// getUserConfigPath returns the config folder of the user who invoked us, which under sudo is theirs
+// rather than root's. owner is that user when files written there have to be handed over to them.
+func getUserConfigPath(defaultUser string) (foldername string, owner *user.User, err error) {
+	owner, err = lookupNonRootUser(defaultUser)
+
 	if err != nil {
-		return fmt.Errorf("failed to parse GID: %w", err)
+		return
+	}
+
+	if owner == nil {
+		foldername, err = getHomeDirConfigPath()
+		return
+	}
+
+	foldername = path.Join(owner.HomeDir, ".config", defaultConfigDirectoryName)
+
+	return
+}
+
+// mkdirAllAsUser is os.MkdirAll, handing every directory it creates over to u so a root process doesn't
+// leave root owned folders in u's home.
+func mkdirAllAsUser(dir string, perm os.FileMode, u *user.User) error {
+	var missing []string
+
+	for d := dir; !fileExists(d); d = path.Dir(d) {
+		missing = append(missing, d)
+	}
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	for _, d := range missing {
+		if err := chownToUser(d, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chownToUser hands filename over to u, a no-op when u is nil.
+func chownToUser(filename string, u *user.User) error {
+	if u == nil {
+		return nil
+	}
+
+	uid, gid, err := userIDs(u)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(filename, uid, gid)
+}
+
+func commandAsNonRoot(defaultUser string, command string, args ...string) (*exec.Cmd, error) {
+	nonRootUser, err := lookupNonRootUser(defaultUser)
+	if err != nil {
+		return nil, err
+	}
+
+	// If we aren't running as root, or root is who invoked us, we just run exec.Command normally.
+	if nonRootUser == nil {
+		cmd := exec.Command(command, args...)
+		cmd.Env = os.Environ()
+		return cmd, nil
+	}
+
+	uid, gid, err := userIDs(nonRootUser)
+	if err != nil {
+		return nil, err
 	}
 
 	// Prepare the command to execute
@@ -196,14 +352,62 @@ func commandAndStartAsNonRoot(defaultUser string, command string, args ...string
 		"HOME="+nonRootUser.HomeDir,
 		"USER="+nonRootUser.Username,
 		"LOGNAME="+nonRootUser.Username,
-		"DISPLAY="+os.Getenv("DISPLAY"),
 		"XDG_RUNTIME_DIR=/run/user/"+nonRootUser.Uid,
 	)
+	cmd.Env = append(cmd.Env, graphicalSessionEnv(nonRootUser.HomeDir, "/run/user/"+nonRootUser.Uid)...)
 
-	// Start the command as the non-root user
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start command: %w", err)
+	return cmd, nil
+}
+
+// graphicalSessionEnv finds the user's X11, Wayland and D-Bus session for programs we start on their
+// behalf. sudo usually resets these, so whatever survived is used and the rest is looked up in the
+// user's runtime dir.
+func graphicalSessionEnv(home, runtimeDir string) (env []string) {
+	display := os.Getenv("DISPLAY")
+
+	if display == "" && fileExists("/tmp/.X11-unix/X0") {
+		display = ":0"
 	}
 
-	return nil
+	if display != "" {
+		env = append(env, "DISPLAY="+display)
+	}
+
+	wayland := os.Getenv("WAYLAND_DISPLAY")
+
+	if wayland == "" {
+		if sockets, _ := filepath.Glob(path.Join(runtimeDir, "wayland-*")); len(sockets) > 0 {
+			for _, socket := range sockets {
+				if !strings.HasSuffix(socket, ".lock") {
+					wayland = path.Base(socket)
+					break
+				}
+			}
+		}
+	}
+
+	if wayland != "" {
+		env = append(env, "WAYLAND_DISPLAY="+wayland)
+	}
+
+	xauthority := os.Getenv("XAUTHORITY")
+
+	if xauthority == "" {
+		if fileExists(path.Join(home, ".Xauthority")) {
+			xauthority = path.Join(home, ".Xauthority")
+		} else if found, _ := filepath.Glob(path.Join(runtimeDir, ".mutter-Xwaylandauth.*")); len(found) > 0 {
+			xauthority = found[0]
+		}
+	}
+
+	if xauthority != "" {
+		env = append(env, "XAUTHORITY="+xauthority)
+	}
+
+	// Root's session bus (if any) isn't the user's, point D-Bus clients at theirs.
+	if bus := path.Join(runtimeDir, "bus"); fileExists(bus) || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		env = append(env, "DBUS_SESSION_BUS_ADDRESS=unix:path="+bus)
+	}
+
+	return
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os/exec"
+	"path"
+	"testing"
+)
+
+func TestCommandExists(t *testing.T) {
+	marker := path.Join(t.TempDir(), "ran")
+
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "sh", want: true},
+		{command: "/bin/sh", want: true},
+		{command: "no-such-command-aws-vpn-client", want: false},
+		{command: "sh; touch " + marker, want: false},
+		{command: "$(touch " + marker + ")", want: false},
+		{command: "`touch " + marker + "`", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := commandExists(tt.command); got != tt.want {
+			t.Errorf("commandExists(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+
+	if fileExists(marker) {
+		t.Error("commandExists ran part of its argument")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/usr/sbin/openvpn", want: "/usr/sbin/openvpn"},
+		{in: "--route-ipv6", want: "--route-ipv6"},
+		{in: "10.1.0.0/16", want: "10.1.0.0/16"},
+		{in: "", want: "''"},
+		{in: "two words", want: "'two words'"},
+		{in: "it's", want: `'it'"'"'s'`},
+		{in: "$(reboot)", want: "'$(reboot)'"},
+		{in: "a;b|c&d`e`", want: "'a;b|c&d`e`'"},
+		{in: "line\nbreak", want: "'line\nbreak'"},
+	}
+
+	for _, tt := range tests {
+		got := shellQuote(tt.in)
+
+		if got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+
+		// Whatever it looks like, the shell has to hand back exactly the input.
+		out, err := exec.Command("/bin/sh", "-c", "printf %s "+got).Output()
+
+		if err != nil || string(out) != tt.in {
+			t.Errorf("sh printed %q, %v for %q, want %q", out, err, got, tt.in)
+		}
+	}
+}